@@ -1,41 +1,95 @@
 package blacklist
 
 import (
+	"context"
+	"log"
+	"socialmedia/config"
+	"socialmedia/utils"
 	"sync"
 	"time"
+
+	"gorm.io/gorm"
 )
 
-type TokenInfo struct {
-	Expiration time.Time
+// Store persists revoked tokens. Implementations only ever see the SHA-256
+// hash of a token, never the raw value.
+type Store interface {
+	// Add records a token hash as revoked until expiration.
+	Add(tokenHash string, expiration time.Time) error
+	// Contains reports whether a token hash is revoked and not yet expired.
+	Contains(tokenHash string, now time.Time) (bool, error)
+	// Purge deletes entries that expired before now and returns how many were removed.
+	Purge(now time.Time) (int64, error)
 }
 
 var (
-	tokens = make(map[string]TokenInfo)
-	mutex  sync.RWMutex
+	store Store = NewMemoryStore()
+	mutex sync.RWMutex
 )
 
-// Add adds a token to the blacklist with its expiration time.
-func Add(token string, expiration time.Time) {
+// SetStore replaces the store used by Add and IsBlacklisted.
+func SetStore(s Store) {
 	mutex.Lock()
 	defer mutex.Unlock()
-	tokens[token] = TokenInfo{Expiration: expiration}
+	store = s
 }
 
-// IsBlacklisted checks if a token is in the blacklist.
-// It also cleans up expired tokens.
-func IsBlacklisted(token string) bool {
-	mutex.RLock()
-	info, exists := tokens[token]
-	mutex.RUnlock()
-	if !exists {
-		return false
+// Configure selects the store named by config.BlacklistStore. The database
+// store is shared by every instance using the same database and survives
+// restarts; the memory store is process-local.
+func Configure(db *gorm.DB) {
+	switch config.BlacklistStore {
+	case "memory":
+		SetStore(NewMemoryStore())
+	case "database":
+		SetStore(NewGormStore(db))
+	default:
+		log.Printf("Unknown BLACKLIST_STORE %q, using database", config.BlacklistStore)
+		SetStore(NewGormStore(db))
 	}
-	if time.Now().After(info.Expiration) {
-		// Remove expired token.
-		mutex.Lock()
-		delete(tokens, token)
-		mutex.Unlock()
-		return false
+}
+
+func current() Store {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return store
+}
+
+// Add adds a token to the blacklist with its expiration time.
+func Add(token string, expiration time.Time) error {
+	return current().Add(utils.HashToken(token), expiration)
+}
+
+// IsBlacklisted checks if a token is in the blacklist. If the store cannot be
+// reached the token is treated as blacklisted.
+func IsBlacklisted(token string) bool {
+	revoked, err := current().Contains(utils.HashToken(token), time.Now())
+	if err != nil {
+		log.Printf("Blacklist lookup failed: %v", err)
+		return true
 	}
-	return true
+	return revoked
+}
+
+// StartSweeper periodically purges expired entries until ctx is cancelled.
+func StartSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				purged, err := current().Purge(now)
+				if err != nil {
+					log.Printf("Blacklist sweep failed: %v", err)
+					continue
+				}
+				if purged > 0 {
+					log.Printf("Blacklist sweep removed %d expired tokens", purged)
+				}
+			}
+		}
+	}()
 }
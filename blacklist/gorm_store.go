@@ -0,0 +1,37 @@
+package blacklist
+
+import (
+	"socialmedia/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormStore keeps revoked token hashes in the revoked_tokens table.
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Add(tokenHash string, expiration time.Time) error {
+	entry := models.RevokedToken{TokenHash: tokenHash, ExpiresAt: expiration}
+	// Logging out twice with the same token is not an error.
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error
+}
+
+func (s *GormStore) Contains(tokenHash string, now time.Time) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.RevokedToken{}).
+		Where("token_hash = ? AND expires_at > ?", tokenHash, now).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *GormStore) Purge(now time.Time) (int64, error) {
+	result := s.db.Where("expires_at <= ?", now).Delete(&models.RevokedToken{})
+	return result.RowsAffected, result.Error
+}
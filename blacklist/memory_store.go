@@ -0,0 +1,48 @@
+package blacklist
+
+import (
+	"sync"
+	"time"
+)
+
+type TokenInfo struct {
+	Expiration time.Time
+}
+
+// MemoryStore keeps revoked tokens in a process-local map. Entries are lost
+// on restart and are not shared between instances.
+type MemoryStore struct {
+	tokens map[string]TokenInfo
+	mutex  sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: make(map[string]TokenInfo)}
+}
+
+func (s *MemoryStore) Add(tokenHash string, expiration time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens[tokenHash] = TokenInfo{Expiration: expiration}
+	return nil
+}
+
+func (s *MemoryStore) Contains(tokenHash string, now time.Time) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	info, exists := s.tokens[tokenHash]
+	return exists && now.Before(info.Expiration), nil
+}
+
+func (s *MemoryStore) Purge(now time.Time) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var purged int64
+	for hash, info := range s.tokens {
+		if !now.Before(info.Expiration) {
+			delete(s.tokens, hash)
+			purged++
+		}
+	}
+	return purged, nil
+}
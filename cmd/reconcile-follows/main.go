@@ -0,0 +1,27 @@
+// Command reconcile-follows recomputes every user's follower and following
+// counters from the follows table.
+//
+//	go run ./cmd/reconcile-follows
+package main
+
+import (
+	"log"
+	"socialmedia/config"
+	"socialmedia/models"
+)
+
+func main() {
+	config.InitConfig()
+
+	// Only the schema: the counters are not in the user search index, so
+	// the command works against any database with or without the
+	// sqlite_fts5 tag.
+	db := models.ConnectDatabase()
+	models.Migrate(db)
+
+	updated, err := models.ReconcileFollowCounts(db)
+	if err != nil {
+		log.Fatal("Failed to reconcile follow counts: ", err)
+	}
+	log.Printf("Reconciled follow counts, %d users updated", updated)
+}
@@ -1,12 +1,28 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// OIDCProvider configures one OpenID Connect identity provider. Endpoints
+// are discovered from Issuer + "/.well-known/openid-configuration".
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
 var (
 	// Database file path (default “socialmedia.db”)
 	DBPath string
@@ -20,6 +36,122 @@ var (
 	OpenRouterAPIKey    string
 	AIModel             string
 	JWTSecret           string
+
+	// Deployment environment. Anything other than "development" (or "dev")
+	// is treated as production and refuses insecure defaults.
+	AppEnv string
+
+	// Directory of <kid>.pem keys used to sign and verify JWTs, and the ID
+	// of the key that signs new tokens.
+	JWTKeysDir      string
+	JWTSigningKeyID string
+
+	// Lifetime of access tokens (JWTs) and of the refresh tokens that renew them.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// OpenID Connect providers available at /api/auth/:provider. Google is
+	// added automatically when GOOGLE_CLIENT_ID is set.
+	OIDCProviders []OIDCProvider
+
+	// Token blacklist backend ("database" or "memory") and how often expired
+	// entries are purged.
+	BlacklistStore         string
+	BlacklistSweepInterval time.Duration
+
+	// Display name of the service (shown in authenticator apps) and the
+	// public URL of the web client, used to build links in emails.
+	AppName string
+	AppURL  string
+	// Public URL of this API, used to build links clients call back on.
+	APIURL string
+
+	// Outgoing mail. MailDriver is "smtp" or "log"; the log driver appends
+	// messages to MailLogPath (or stderr when empty).
+	MailDriver   string
+	MailFrom     string
+	MailLogPath  string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// How long a password reset link stays valid.
+	PasswordResetTTL time.Duration
+
+	// When set, accounts must verify their email before they can create
+	// content. EmailVerificationTTL bounds how long a verification link works.
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+
+	// How long a magic login link stays valid.
+	MagicLinkTTL time.Duration
+
+	// How long a deleted account can still be restored, and how often
+	// accounts past that grace period are purged.
+	AccountDeletionGracePeriod time.Duration
+	AccountPurgeInterval       time.Duration
+
+	// How long cached follow suggestions are served before being
+	// recomputed, and how often stale caches of active users are refreshed.
+	SuggestionsTTL             time.Duration
+	SuggestionsRefreshInterval time.Duration
+
+	// Where uploaded media is stored: "local", "s3" or "uploadcare".
+	// Defaults to uploadcare when UPLOADCARE_PUBLIC_KEY is set and to local
+	// otherwise.
+	StorageBackend string
+	// Local storage keeps files under StorageLocalDir and serves them from
+	// StorageLocalURL, which should point at this API's /media route.
+	StorageLocalDir string
+	StorageLocalURL string
+	// S3-compatible storage. S3PublicURL is the base URL objects are served
+	// from; it defaults to the bucket's path-style URL on S3Endpoint.
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3UseSSL    bool
+	S3PublicURL string
+	// Uploadcare endpoints, overridable for testing.
+	UploadcareUploadURL string
+	UploadcareAPIURL    string
+	UploadcareCDNURL    string
+
+	// RequestBodyLimit is how many bytes a request body may hold on routes
+	// that don't accept files.
+	RequestBodyLimit int
+
+	// Upload limits. MaxUploadSize is in bytes and applies to each file;
+	// MaxUploadFiles bounds the files in one request. UploadAllowedTypes
+	// lists the content types accepted, as sniffed from the file's first
+	// bytes. UserStorageQuota is how many bytes of media each user can
+	// store, 0 for no limit.
+	MaxUploadSize      int64
+	MaxUploadFiles     int
+	UploadAllowedTypes []string
+	UserStorageQuota   int64
+	// Direct uploads: how long an upload URL stays valid, how many
+	// uploads a user may have open at once, how long uploaded media may
+	// wait to be attached to a post before it is deleted, and how often
+	// expired uploads are swept.
+	UploadURLExpiry     time.Duration
+	MaxOpenUploads      int
+	PendingMediaTTL     time.Duration
+	UploadSweepInterval time.Duration
+
+	// Login throttling: failures per account (or per IP) within
+	// LoginFailureWindow before the account (or IP) is locked out for
+	// LoginLockoutDuration.
+	LoginMaxFailures     int
+	LoginIPMaxFailures   int
+	LoginFailureWindow   time.Duration
+	LoginLockoutDuration time.Duration
+
+	// Accounts with these emails are given the admin role at startup, so a
+	// fresh install always has an administrator.
+	AdminEmails []string
 )
 
 func InitConfig() {
@@ -42,8 +174,239 @@ func InitConfig() {
 	OpenRouterAPIKey = os.Getenv("OPENROUTER_API_KEY")
 	AIModel = os.Getenv("OpenRouterModel")
 
+	AppEnv = strings.ToLower(os.Getenv("APP_ENV"))
+	if AppEnv == "" {
+		AppEnv = "production"
+	}
+
+	// JWT_SECRET signs short-lived cookies such as the OAuth state; tokens
+	// themselves are signed with the keys in JWT_KEYS_DIR.
 	JWTSecret = os.Getenv("JWT_SECRET")
-	if JWTSecret == "" {
-		JWTSecret = "secret"
+	if JWTSecret == "" || JWTSecret == "secret" {
+		if !IsDevelopment() {
+			log.Fatal("JWT_SECRET must be set to a long random value outside development (APP_ENV=development)")
+		}
+		JWTSecret = randomSecret()
+		log.Println("JWT_SECRET not set, using a temporary secret")
+	} else if len(JWTSecret) < 32 {
+		log.Println("JWT_SECRET is shorter than 32 characters; use a longer random value")
+	}
+	JWTKeysDir = os.Getenv("JWT_KEYS_DIR")
+	JWTSigningKeyID = os.Getenv("JWT_SIGNING_KEY_ID")
+
+	AccessTokenTTL = durationEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	RefreshTokenTTL = durationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
+	OIDCProviders = loadOIDCProviders()
+
+	BlacklistStore = os.Getenv("BLACKLIST_STORE")
+	if BlacklistStore == "" {
+		BlacklistStore = "database"
+	}
+	BlacklistSweepInterval = durationEnv("BLACKLIST_SWEEP_INTERVAL", 10*time.Minute)
+
+	AppName = os.Getenv("APP_NAME")
+	if AppName == "" {
+		AppName = "SocialHub"
+	}
+	AppURL = os.Getenv("APP_URL")
+	if AppURL == "" {
+		AppURL = "http://localhost:3000"
+	}
+	APIURL = strings.TrimSuffix(os.Getenv("API_URL"), "/")
+	if APIURL == "" {
+		APIURL = "http://localhost:8000"
+	}
+
+	MailDriver = os.Getenv("MAIL_DRIVER")
+	if MailDriver == "" {
+		MailDriver = "log"
+	}
+	MailFrom = os.Getenv("MAIL_FROM")
+	if MailFrom == "" {
+		MailFrom = "no-reply@localhost"
+	}
+	MailLogPath = os.Getenv("MAIL_LOG_PATH")
+	SMTPHost = os.Getenv("SMTP_HOST")
+	SMTPPort = os.Getenv("SMTP_PORT")
+	if SMTPPort == "" {
+		SMTPPort = "587"
+	}
+	SMTPUsername = os.Getenv("SMTP_USERNAME")
+	SMTPPassword = os.Getenv("SMTP_PASSWORD")
+
+	PasswordResetTTL = durationEnv("PASSWORD_RESET_TTL", time.Hour)
+
+	RequireEmailVerification = boolEnv("REQUIRE_EMAIL_VERIFICATION", false)
+	EmailVerificationTTL = durationEnv("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+	MagicLinkTTL = durationEnv("MAGIC_LINK_TTL", 15*time.Minute)
+	AccountDeletionGracePeriod = durationEnv("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
+	AccountPurgeInterval = durationEnv("ACCOUNT_PURGE_INTERVAL", time.Hour)
+	SuggestionsTTL = durationEnv("SUGGESTIONS_TTL", 6*time.Hour)
+	SuggestionsRefreshInterval = durationEnv("SUGGESTIONS_REFRESH_INTERVAL", 30*time.Minute)
+
+	StorageBackend = os.Getenv("STORAGE_BACKEND")
+	if StorageBackend == "" {
+		StorageBackend = "local"
+		if UploadcarePublicKey != "" {
+			StorageBackend = "uploadcare"
+		}
+	}
+	StorageLocalDir = os.Getenv("STORAGE_LOCAL_DIR")
+	if StorageLocalDir == "" {
+		StorageLocalDir = "uploads"
+	}
+	StorageLocalURL = strings.TrimSuffix(os.Getenv("STORAGE_LOCAL_URL"), "/")
+	if StorageLocalURL == "" {
+		StorageLocalURL = APIURL + "/media"
+	}
+	S3Endpoint = os.Getenv("S3_ENDPOINT")
+	S3Region = os.Getenv("S3_REGION")
+	S3Bucket = os.Getenv("S3_BUCKET")
+	S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+	S3SecretKey = os.Getenv("S3_SECRET_KEY")
+	S3UseSSL = boolEnv("S3_USE_SSL", true)
+	S3PublicURL = strings.TrimSuffix(os.Getenv("S3_PUBLIC_URL"), "/")
+	UploadcareUploadURL = os.Getenv("UPLOADCARE_UPLOAD_URL")
+	if UploadcareUploadURL == "" {
+		UploadcareUploadURL = "https://upload.uploadcare.com"
+	}
+	UploadcareAPIURL = os.Getenv("UPLOADCARE_API_URL")
+	if UploadcareAPIURL == "" {
+		UploadcareAPIURL = "https://api.uploadcare.com"
+	}
+	UploadcareCDNURL = os.Getenv("UPLOADCARE_CDN_URL")
+	if UploadcareCDNURL == "" {
+		UploadcareCDNURL = "https://ucarecdn.com"
+	}
+
+	RequestBodyLimit = intEnv("REQUEST_BODY_LIMIT", 1<<20)
+	MaxUploadSize = int64(intEnv("MAX_UPLOAD_SIZE", 10<<20))
+	MaxUploadFiles = intEnv("MAX_UPLOAD_FILES", 10)
+	UploadAllowedTypes = nil
+	for _, t := range strings.Split(os.Getenv("UPLOAD_ALLOWED_TYPES"), ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			UploadAllowedTypes = append(UploadAllowedTypes, t)
+		}
+	}
+	if len(UploadAllowedTypes) == 0 {
+		UploadAllowedTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "video/mp4", "video/webm"}
+	}
+	UserStorageQuota = int64(intEnv("USER_STORAGE_QUOTA", 1<<30))
+	UploadURLExpiry = durationEnv("UPLOAD_URL_EXPIRY", 15*time.Minute)
+	MaxOpenUploads = intEnv("MAX_OPEN_UPLOADS", 20)
+	PendingMediaTTL = durationEnv("PENDING_MEDIA_TTL", 24*time.Hour)
+	UploadSweepInterval = durationEnv("UPLOAD_SWEEP_INTERVAL", time.Hour)
+
+	LoginMaxFailures = intEnv("LOGIN_MAX_FAILURES", 5)
+	LoginIPMaxFailures = intEnv("LOGIN_IP_MAX_FAILURES", 50)
+	LoginFailureWindow = durationEnv("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+	LoginLockoutDuration = durationEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+
+	AdminEmails = nil
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			AdminEmails = append(AdminEmails, email)
+		}
+	}
+}
+
+// loadOIDCProviders reads OIDC_PROVIDERS, a comma-separated list of provider
+// names, and for each name the OIDC_<NAME>_ISSUER, _CLIENT_ID,
+// _CLIENT_SECRET, _REDIRECT_URL and optional _SCOPES variables.
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	if GoogleClientID != "" {
+		providers = append(providers, OIDCProvider{
+			Name:         "google",
+			Issuer:       "https://accounts.google.com",
+			ClientID:     GoogleClientID,
+			ClientSecret: GoogleClientSecret,
+			RedirectURL:  GoogleRedirectURL,
+			Scopes:       []string{"openid", "email", "profile"},
+		})
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Printf("Skipping OIDC provider %q: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+			continue
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// IsDevelopment reports whether the server runs in development mode.
+func IsDevelopment() bool {
+	return AppEnv == "development" || AppEnv == "dev"
+}
+
+func randomSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Failed to generate secret: ", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// durationEnv reads a duration such as "15m" or "720h" from the environment,
+// falling back to def when the variable is unset or invalid.
+func durationEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration %q for %s, using %s", value, key, def)
+		return def
+	}
+	return d
+}
+
+// boolEnv reads a boolean such as "true" or "0" from the environment,
+// falling back to def when the variable is unset or invalid.
+func boolEnv(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean %q for %s, using %t", value, key, def)
+		return def
+	}
+	return b
+}
+
+// intEnv reads an integer from the environment, falling back to def when the
+// variable is unset or invalid.
+func intEnv(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer %q for %s, using %d", value, key, def)
+		return def
 	}
+	return i
 }
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"socialmedia/config"
+	"socialmedia/mailer"
+	"socialmedia/models"
+	"socialmedia/services/account"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type DeleteAccountInput struct {
+	// Password is required for accounts that have one.
+	Password string `json:"password"`
+	// Confirm must equal the account's email for accounts without a password.
+	Confirm string `json:"confirm"`
+}
+
+type AccountDeletionResponse struct {
+	Message             string     `json:"message"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// ExportAccount godoc
+// @Summary Export your data
+// @Description Download a ZIP archive with JSON files for the account and everything it owns: posts, comments, likes, follows, AI chat messages, projects, features, PRDs, sessions and linked accounts.
+// @Tags User
+// @Produce application/zip
+// @Success 200 {file} file
+// @Failure 500 {object} ErrorResponse
+// @Router /api/me/export [get]
+// @Security ApiKeyAuth
+func ExportAccount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var buf bytes.Buffer
+	if err := account.Export(models.DB, userID, &buf); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to export account"})
+	}
+
+	filename := fmt.Sprintf("socialhub-export-%d-%s.zip", userID, time.Now().Format("20060102"))
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Send(buf.Bytes())
+}
+
+// DeleteAccount godoc
+// @Summary Delete your account
+// @Description Schedule the account for permanent deletion and log out everywhere. The account can be restored by logging in and cancelling before the grace period ends; after that it and all its content are purged.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param deleteAccountInput body DeleteAccountInput true "Password, or email confirmation for accounts without one"
+// @Success 200 {object} AccountDeletionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/me [delete]
+// @Security ApiKeyAuth
+func DeleteAccount(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var input DeleteAccountInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request payload"})
+	}
+	if user.Password != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid password"})
+		}
+	} else if input.Confirm != user.Email {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Confirm by sending your email address as confirm"})
+	}
+
+	// Without a grace period there is nothing to wait for.
+	if config.AccountDeletionGracePeriod <= 0 {
+		if err := account.Purge(models.DB, user.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to delete account"})
+		}
+		return c.JSON(AccountDeletionResponse{Message: "Account deleted"})
+	}
+
+	scheduledAt := time.Now().Add(config.AccountDeletionGracePeriod)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("deletion_scheduled_at", scheduledAt).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		return revokeAllSessions(tx, user.ID)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to delete account"})
+	}
+
+	mailer.SendAsync(mailer.Message{
+		To:      user.Email,
+		Subject: "Your " + config.AppName + " account will be deleted",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account and everything you posted will be permanently deleted on %s.\n\nChanged your mind? Log in before then and cancel the deletion from your settings.",
+			user.Name, scheduledAt.Format("2 January 2006")),
+	})
+
+	return c.JSON(AccountDeletionResponse{
+		Message:             "Account scheduled for deletion",
+		DeletionScheduledAt: &scheduledAt,
+	})
+}
+
+// CancelAccountDeletion godoc
+// @Summary Cancel account deletion
+// @Description Keep an account that was scheduled for deletion
+// @Tags User
+// @Produce json
+// @Success 200 {object} AccountDeletionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/me/deletion/cancel [post]
+// @Security ApiKeyAuth
+func CancelAccountDeletion(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if user.DeletionScheduledAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Account is not scheduled for deletion"})
+	}
+
+	if err := models.DB.Model(&user).Update("deletion_scheduled_at", nil).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to cancel deletion"})
+	}
+	return c.JSON(AccountDeletionResponse{Message: "Account deletion cancelled"})
+}
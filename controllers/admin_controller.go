@@ -0,0 +1,398 @@
+package controllers
+
+import (
+	"socialmedia/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AdminUserResponse is a user as seen by moderators and admins.
+type AdminUserResponse struct {
+	ID               uint       `json:"id"`
+	Email            string     `json:"email"`
+	Name             string     `json:"name"`
+	Username         string     `json:"username"`
+	Role             string     `json:"role"`
+	EmailVerified    bool       `json:"email_verified"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	SuspendedAt      *time.Time `json:"suspended_at"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+func newAdminUserResponse(u models.User) AdminUserResponse {
+	return AdminUserResponse{
+		ID:               u.ID,
+		Email:            u.Email,
+		Name:             u.Name,
+		Username:         u.Username,
+		Role:             u.Role,
+		EmailVerified:    u.EmailVerifiedAt != nil,
+		TwoFactorEnabled: u.TwoFactorEnabled,
+		SuspendedAt:      u.SuspendedAt,
+		SuspensionReason: u.SuspensionReason,
+		CreatedAt:        u.CreatedAt,
+	}
+}
+
+type SuspendUserInput struct {
+	Reason string `json:"reason"`
+}
+
+type UpdateRoleInput struct {
+	Role string `json:"role"`
+}
+
+// AdminStatsResponse summarises the state of the system.
+type AdminStatsResponse struct {
+	Users          int64 `json:"users"`
+	VerifiedUsers  int64 `json:"verified_users"`
+	SuspendedUsers int64 `json:"suspended_users"`
+	Moderators     int64 `json:"moderators"`
+	Admins         int64 `json:"admins"`
+	NewUsers24h    int64 `json:"new_users_24h"`
+	Posts          int64 `json:"posts"`
+	NewPosts24h    int64 `json:"new_posts_24h"`
+	Comments       int64 `json:"comments"`
+	Likes          int64 `json:"likes"`
+	ActiveSessions int64 `json:"active_sessions"`
+}
+
+// AdminListUsers godoc
+// @Summary List users
+// @Description List users with optional filters. Requires the moderator role.
+// @Tags Admin
+// @Produce json
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Param q query string false "Search email, username or name"
+// @Param role query string false "Filter by role"
+// @Param suspended query bool false "Filter by suspension"
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users [get]
+// @Security ApiKeyAuth
+func AdminListUsers(c *fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := models.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + q + "%"
+		query = query.Where("email LIKE ? OR username LIKE ? OR name LIKE ?", like, like, like)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	switch c.Query("suspended") {
+	case "true":
+		query = query.Where("suspended_at IS NOT NULL")
+	case "false":
+		query = query.Where("suspended_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to count users"})
+	}
+
+	var users []models.User
+	if err := query.Order("created_at desc").Limit(limit).Offset((page - 1) * limit).Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch users"})
+	}
+
+	response := make([]AdminUserResponse, 0, len(users))
+	for _, u := range users {
+		response = append(response, newAdminUserResponse(u))
+	}
+	return c.JSON(fiber.Map{
+		"users": response,
+		"metadata": fiber.Map{
+			"total":       total,
+			"page":        page,
+			"limit":       limit,
+			"total_pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// AdminGetUser godoc
+// @Summary Get a user
+// @Description Requires the moderator role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/users/{id} [get]
+// @Security ApiKeyAuth
+func AdminGetUser(c *fiber.Ctx) error {
+	target, ok := findTargetUser(c)
+	if !ok {
+		return nil
+	}
+	return c.JSON(newAdminUserResponse(*target))
+}
+
+// AdminSuspendUser godoc
+// @Summary Suspend a user
+// @Description Suspend a user and log them out everywhere. Moderators can only suspend regular users. Requires the moderator role.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param suspendUserInput body SuspendUserInput false "Reason"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/suspend [post]
+// @Security ApiKeyAuth
+func AdminSuspendUser(c *fiber.Ctx) error {
+	actor := c.Locals("user").(models.User)
+	target, ok := findTargetUser(c)
+	if !ok {
+		return nil
+	}
+	if !actor.Outranks(target) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: "You cannot suspend this user"})
+	}
+
+	var input SuspendUserInput
+	// The reason is optional, so an empty body is fine.
+	_ = c.BodyParser(&input)
+
+	now := time.Now()
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(target).Updates(map[string]interface{}{
+			"suspended_at":      now,
+			"suspension_reason": strings.TrimSpace(input.Reason),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", target.ID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		return revokeAllSessions(tx, target.ID)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to suspend user"})
+	}
+	return c.JSON(newAdminUserResponse(*target))
+}
+
+// AdminUnsuspendUser godoc
+// @Summary Lift a suspension
+// @Description Requires the moderator role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/unsuspend [post]
+// @Security ApiKeyAuth
+func AdminUnsuspendUser(c *fiber.Ctx) error {
+	actor := c.Locals("user").(models.User)
+	target, ok := findTargetUser(c)
+	if !ok {
+		return nil
+	}
+	if !actor.Outranks(target) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: "You cannot unsuspend this user"})
+	}
+
+	if err := models.DB.Model(target).Updates(map[string]interface{}{
+		"suspended_at":      nil,
+		"suspension_reason": "",
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to unsuspend user"})
+	}
+	return c.JSON(newAdminUserResponse(*target))
+}
+
+// AdminUpdateRole godoc
+// @Summary Change a user's role
+// @Description Set a user's role to user, moderator or admin. Requires the admin role.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param updateRoleInput body UpdateRoleInput true "New role"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/role [put]
+// @Security ApiKeyAuth
+func AdminUpdateRole(c *fiber.Ctx) error {
+	actor := c.Locals("user").(models.User)
+	target, ok := findTargetUser(c)
+	if !ok {
+		return nil
+	}
+
+	var input UpdateRoleInput
+	if err := c.BodyParser(&input); err != nil || !models.IsValidRole(input.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Role must be one of user, moderator or admin"})
+	}
+	// Admins cannot demote themselves, so there is always at least one.
+	if target.ID == actor.ID && input.Role != models.RoleAdmin {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "You cannot change your own role"})
+	}
+
+	if err := models.DB.Model(target).Update("role", input.Role).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update role"})
+	}
+	return c.JSON(newAdminUserResponse(*target))
+}
+
+// AdminDeletePost godoc
+// @Summary Delete any post
+// @Description Delete a post regardless of its author. Requires the moderator role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "Post ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/posts/{id} [delete]
+// @Security ApiKeyAuth
+func AdminDeletePost(c *fiber.Ctx) error {
+	postID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid post ID"})
+	}
+
+	var post models.Post
+	if err := models.DB.First(&post, postID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Post not found"})
+	}
+	if err := deletePost(c.UserContext(), &post); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to delete post"})
+	}
+	return c.JSON(MessageResponse{Message: "Post deleted"})
+}
+
+// AdminDeleteComment godoc
+// @Summary Delete any comment
+// @Description Delete a comment and its replies regardless of the author. Requires the moderator role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "Comment ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/comments/{id} [delete]
+// @Security ApiKeyAuth
+func AdminDeleteComment(c *fiber.Ctx) error {
+	commentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid comment ID"})
+	}
+
+	var comment models.Comment
+	if err := models.DB.First(&comment, commentID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Comment not found"})
+	}
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteComment(tx, comment)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to delete comment"})
+	}
+	return c.JSON(MessageResponse{Message: "Comment deleted"})
+}
+
+// AdminStats godoc
+// @Summary System statistics
+// @Description Counts of users, content and sessions. Requires the moderator role.
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} AdminStatsResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/stats [get]
+// @Security ApiKeyAuth
+func AdminStats(c *fiber.Ctx) error {
+	now := time.Now()
+	dayAgo := now.Add(-24 * time.Hour)
+
+	var stats AdminStatsResponse
+	counts := []struct {
+		dest  *int64
+		query *gorm.DB
+	}{
+		{&stats.Users, models.DB.Model(&models.User{})},
+		{&stats.VerifiedUsers, models.DB.Model(&models.User{}).Where("email_verified_at IS NOT NULL")},
+		{&stats.SuspendedUsers, models.DB.Model(&models.User{}).Where("suspended_at IS NOT NULL")},
+		{&stats.Moderators, models.DB.Model(&models.User{}).Where("role = ?", models.RoleModerator)},
+		{&stats.Admins, models.DB.Model(&models.User{}).Where("role = ?", models.RoleAdmin)},
+		{&stats.NewUsers24h, models.DB.Model(&models.User{}).Where("created_at >= ?", dayAgo)},
+		{&stats.Posts, models.DB.Model(&models.Post{})},
+		{&stats.NewPosts24h, models.DB.Model(&models.Post{}).Where("created_at >= ?", dayAgo)},
+		{&stats.Comments, models.DB.Model(&models.Comment{})},
+		{&stats.Likes, models.DB.Model(&models.Like{})},
+		{&stats.ActiveSessions, models.DB.Model(&models.Session{}).Where("revoked_at IS NULL AND expires_at > ?", now)},
+	}
+	for _, count := range counts {
+		if err := count.query.Count(count.dest).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to compute stats"})
+		}
+	}
+	return c.JSON(stats)
+}
+
+// ReconcileResponse reports the outcome of a counter reconciliation.
+type ReconcileResponse struct {
+	Message      string `json:"message"`
+	UsersUpdated int64  `json:"users_updated"`
+}
+
+// AdminReconcileFollowCounts godoc
+// @Summary Reconcile follow counters
+// @Description Recompute every user's follower and following counts from the follows table. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} ReconcileResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/follows/reconcile [post]
+// @Security ApiKeyAuth
+func AdminReconcileFollowCounts(c *fiber.Ctx) error {
+	updated, err := models.ReconcileFollowCounts(models.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to reconcile follow counts"})
+	}
+	return c.JSON(ReconcileResponse{Message: "Follow counts reconciled", UsersUpdated: updated})
+}
+
+// findTargetUser loads the user named by the :id parameter. When it returns
+// false the error response has already been written.
+func findTargetUser(c *fiber.Ctx) (*models.User, bool) {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, userID).Error; err != nil {
+		c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
@@ -13,8 +13,9 @@ import (
 	"strconv"
 	"time"
 
+	"socialmedia/config"
 	"socialmedia/models"
-	"socialmedia/services"
+	"socialmedia/services/storage"
 
 	openai "github.com/ElvinEga/go-openai"
 	"github.com/gofiber/fiber/v2"
@@ -60,6 +61,7 @@ type Request struct {
 // @Param request body Request true "Initial prompt from the user"
 // @Success 201 {object} AIChatPostResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
 // @Router /api/ai-posts [post]
 func CreateAIChatPost(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
@@ -79,8 +81,37 @@ func CreateAIChatPost(c *fiber.Ctx) error {
 		})
 	}
 
-	// Start a transaction
+	// Check the upload limits before anything is stored.
+	var files []*multipart.FileHeader
+	if form.File != nil {
+		files = form.File["files"]
+	}
+	if len(files) > maxPostMedia {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": mediaErrorMessage(errTooManyMedia),
+		})
+	}
+	if len(files) > config.MaxUploadFiles {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": mediaErrorMessage(errTooManyFiles),
+		})
+	}
+	for _, file := range files {
+		if file.Size > config.MaxUploadSize {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": mediaErrorMessage(errFileTooLarge),
+			})
+		}
+	}
+
+	// Start a transaction. The media files are stored as they are saved,
+	// so they are deleted again if the transaction is rolled back.
 	tx := models.DB.Begin()
+	var stored []string
+	rollback := func() {
+		tx.Rollback()
+		storage.DeleteAll(c.UserContext(), stored)
+	}
 
 	// Create a new Post with PostType "ai"
 	post := models.Post{
@@ -90,50 +121,48 @@ func CreateAIChatPost(c *fiber.Ctx) error {
 	}
 
 	if err := tx.Create(&post).Error; err != nil {
-		tx.Rollback()
+		rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
 	// Handle file uploads if any
-	if form.File != nil {
-		files := form.File["files"]
-		if len(files) > 0 {
-			uploadcareService := services.GetUploadcareService()
-
-			for _, file := range files {
-				// Upload file to Uploadcare
-				uploadResult, err := uploadcareService.UploadFile(file)
-				if err != nil {
-					tx.Rollback()
-					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-						"error": fmt.Sprintf("Failed to upload file: %v", err),
-					})
-				}
-
-				// Create Media record
-				mediaType := services.DetermineMediaType(uploadResult.MimeType)
-				mediaItem := models.Media{
-					PostID:  post.ID,
-					UserID:  userID,
-					URL:     uploadResult.URL,
-					Type:    mediaType,
-					AltText: filepath.Base(file.Filename),
-				}
-
-				if err := tx.Create(&mediaItem).Error; err != nil {
-					tx.Rollback()
-					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-						"error": "Failed to save media item",
-					})
-				}
-			}
+	for i, file := range files {
+		// Upload file to the storage backend
+		src, err := file.Open()
+		if err != nil {
+			rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to read uploaded file",
+			})
+		}
+		mediaItem := models.Media{
+			PostID:   &post.ID,
+			UserID:   userID,
+			AltText:  filepath.Base(file.Filename),
+			Position: i,
+		}
+		keys, err := saveMedia(c.UserContext(), tx, &mediaItem, src)
+		src.Close()
+		stored = append(stored, keys...)
+		if msg := mediaErrorMessage(err); msg != "" {
+			rollback()
+			return c.Status(mediaErrorStatus(err)).JSON(fiber.Map{
+				"error": msg,
+			})
+		}
+		if err != nil {
+			rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": fmt.Sprintf("Failed to upload file: %v", err),
+			})
 		}
 	}
 
 	// Commit the transaction
 	if err := tx.Commit().Error; err != nil {
+		storage.DeleteAll(c.UserContext(), stored)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to commit transaction",
 		})
@@ -141,7 +170,7 @@ func CreateAIChatPost(c *fiber.Ctx) error {
 
 	// Reload the post with all relationships
 	var completePost models.Post
-	if err := models.DB.Preload("Media").First(&completePost, post.ID).Error; err != nil {
+	if err := models.DB.Scopes(models.PreloadMedia).First(&completePost, post.ID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to load post relationships",
 		})
@@ -222,22 +251,27 @@ func AddChatMessage(c *fiber.Ctx) error {
 // @Param id path int true "AI Chat Post ID"
 // @Success 200 {object} AIChatPostResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Router /api/ai-posts/{id} [get]
 func GetAIChatPost(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
 	postID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid post ID"})
 	}
 
 	var post models.Post
-	if err := models.DB.Preload("Media").First(&post, postID).Error; err != nil {
+	if err := models.DB.Scopes(models.PreloadMedia).First(&post, postID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
 	}
 
 	if post.PostType != "ai" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Not an AI chat post"})
 	}
+	if !checkNotBlocked(c, userID, post.UserID) || !checkCanSeeContent(c, userID, post.UserID) {
+		return nil
+	}
 
 	var messages []models.ChatMessage
 	models.DB.Where("post_id = ?", post.ID).Order("created_at asc").Find(&messages)
@@ -277,9 +311,12 @@ func GetAIChatPost(c *fiber.Ctx) error {
 // @Param request body Request true "Chat message data"
 // @Success 200 "Streamed OpenAI response"
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/ai-posts/{id}/messages [post]
 func SendAIChatMessage(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
 	// Parse the AI Chat Post ID from the URL.
 	postID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -294,6 +331,9 @@ func SendAIChatMessage(c *fiber.Ctx) error {
 	if post.PostType != "ai" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Post is not an AI chat post"})
 	}
+	if !checkNotBlocked(c, userID, post.UserID) || !checkCanSeeContent(c, userID, post.UserID) {
+		return nil
+	}
 
 	// Parse the request body to get the user's prompt.
 	type Request struct {
@@ -1,10 +1,15 @@
 package controllers
 
 import (
+	"log"
+	"math"
 	"socialmedia/blacklist"
 	"socialmedia/config"
+	"socialmedia/keyring"
 	"socialmedia/models"
+	"socialmedia/services/loginguard"
 	"socialmedia/utils"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,18 +18,26 @@ import (
 )
 
 type AuthResponse struct {
-	Status  string        `json:"status"`
-	Message string        `json:"message"`
-	Token   string        `json:"token,omitempty"` // Token is optional
-	User    *UserResponse `json:"user,omitempty"`  // User is optional
+	Status       string        `json:"status"`
+	Message      string        `json:"message"`
+	Token        string        `json:"token,omitempty"`         // Token is optional
+	RefreshToken string        `json:"refresh_token,omitempty"` // Returned alongside Token
+	ExpiresIn    int64         `json:"expires_in,omitempty"`    // Access token lifetime in seconds
+	User         *UserResponse `json:"user,omitempty"`          // User is optional
+
+	// ChallengeToken is returned instead of Token when the account has
+	// two-factor authentication enabled; exchange it at /api/login/2fa.
+	ChallengeToken string `json:"challenge_token,omitempty"`
 }
 
 type UserResponse struct {
 	ID             uint   `json:"id"`
 	Email          string `json:"email"`
+	EmailVerified  bool   `json:"email_verified"`
 	Name           string `json:"name"`
 	Username       string `json:"username"`
 	ProfilePicture string `json:"profile_picture"`
+	Role           string `json:"role"`
 }
 
 type RegisterInput struct {
@@ -89,8 +102,13 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate a JWT token.
-	token, err := generateJWT(user.ID)
+	// Ask the user to confirm they own the email address.
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Could not send verification email to user %d: %v", user.ID, err)
+	}
+
+	// Start a session and generate its tokens.
+	tokens, err := startSession(c, user.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
 			Status:  "error",
@@ -99,9 +117,11 @@ func Register(c *fiber.Ctx) error {
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(AuthResponse{
-		Status:  "success",
-		Message: "User registered successfully",
-		Token:   token,
+		Status:       "success",
+		Message:      "User registered successfully",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(config.AccessTokenTTL.Seconds()),
 	})
 }
 
@@ -112,7 +132,7 @@ type LoginInput struct {
 
 // Login godoc
 // @Summary Login user
-// @Description Login a user with email and password
+// @Description Login a user with email and password. If two-factor authentication is enabled the response has status "2fa_required" and a challenge_token to exchange at /api/login/2fa. Repeated failures are throttled per account and per IP; throttled requests get 429 with a Retry-After header.
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -120,36 +140,120 @@ type LoginInput struct {
 // @Success 200 {object} AuthResponse
 // @Failure 400 {object} AuthResponse
 // @Failure 401 {object} AuthResponse
+// @Failure 429 {object} AuthResponse
 // @Failure 500 {object} AuthResponse
 // @Router /api/login [post]
-func Login(c *fiber.Ctx) error {
-	var input LoginInput
-	if err := c.BodyParser(&input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
-			Status:  "error",
-			Message: "Invalid request payload",
-		})
+func Login(guard *loginguard.Guard) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input LoginInput
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Invalid request payload",
+			})
+		}
+
+		// Refuse throttled attempts before spending a bcrypt comparison on them.
+		attempt := loginguard.Attempt{Email: input.Email, IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+		wait, err := guard.Check(attempt)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Could not process login",
+			})
+		}
+		if wait > 0 {
+			return tooManyAttempts(c, wait)
+		}
+
+		// Look up the user by email.
+		var user models.User
+		if err := models.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+			return loginFailed(c, guard, attempt, loginguard.ReasonInvalidCredentials, "Invalid email or password")
+		}
+
+		// Compare the provided password with the hashed password.
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+			attempt.UserID = &user.ID
+			return loginFailed(c, guard, attempt, loginguard.ReasonInvalidCredentials, "Invalid email or password")
+		}
+
+		// With two-factor authentication the login only completes once a
+		// code is verified. Code failures count against the same account,
+		// so clearing them here would let anyone with the password keep
+		// guessing codes.
+		if !user.TwoFactorEnabled {
+			if err := guard.Succeed(user.Email); err != nil {
+				log.Printf("Could not reset login failures for user %d: %v", user.ID, err)
+			}
+		}
+		return beginLogin(c, user)
+	}
+}
+
+// loginFailed records a failed attempt and responds with 401, telling the
+// client when it may retry if the failure triggered a backoff.
+func loginFailed(c *fiber.Ctx, guard *loginguard.Guard, attempt loginguard.Attempt, reason, message string) error {
+	wait, err := guard.Fail(attempt, reason)
+	if err != nil {
+		log.Printf("Could not record failed login for %s: %v", attempt.Email, err)
+	}
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, retryAfterSeconds(wait))
 	}
+	return c.Status(fiber.StatusUnauthorized).JSON(AuthResponse{
+		Status:  "error",
+		Message: message,
+	})
+}
 
-	// Look up the user by email.
-	var user models.User
-	if err := models.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(AuthResponse{
+// tooManyAttempts responds to a throttled login attempt.
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	seconds := retryAfterSeconds(wait)
+	c.Set(fiber.HeaderRetryAfter, seconds)
+	return c.Status(fiber.StatusTooManyRequests).JSON(AuthResponse{
+		Status:  "error",
+		Message: "Too many failed login attempts. Try again in " + seconds + " seconds.",
+	})
+}
+
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10)
+}
+
+// beginLogin finishes a successful first-factor login. Accounts with
+// two-factor authentication get a challenge token that must be exchanged
+// with a TOTP code; everyone else gets a session straight away.
+func beginLogin(c *fiber.Ctx, user models.User) error {
+	if user.IsSuspended() {
+		return c.Status(fiber.StatusForbidden).JSON(AuthResponse{
 			Status:  "error",
-			Message: "Invalid email or password",
+			Message: "Account suspended",
 		})
 	}
 
-	// Compare the provided password with the hashed password.
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(AuthResponse{
-			Status:  "error",
-			Message: "Invalid email or password",
+	if user.TwoFactorEnabled {
+		challenge, err := generateChallengeToken(user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Could not create token",
+			})
+		}
+		return c.JSON(AuthResponse{
+			Status:         "2fa_required",
+			Message:        "Two-factor authentication code required",
+			ChallengeToken: challenge,
 		})
 	}
 
-	// Generate JWT token.
-	token, err := generateJWT(user.ID)
+	return completeLogin(c, user)
+}
+
+// completeLogin starts a session for an authenticated user and responds with
+// its tokens.
+func completeLogin(c *fiber.Ctx, user models.User) error {
+	tokens, err := startSession(c, user.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
 			Status:  "error",
@@ -160,72 +264,41 @@ func Login(c *fiber.Ctx) error {
 	userResponse := UserResponse{
 		ID:             user.ID,
 		Email:          user.Email,
+		EmailVerified:  user.EmailVerifiedAt != nil,
 		Name:           user.Name,
 		Username:       user.Username,
 		ProfilePicture: user.ProfilePicture,
+		Role:           user.Role,
 	}
 
 	return c.JSON(AuthResponse{
-		Status:  "success",
-		Message: "Login successful",
-		Token:   token,
-		User:    &userResponse,
+		Status:       "success",
+		Message:      "Login successful",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(config.AccessTokenTTL.Seconds()),
+		User:         &userResponse,
 	})
 }
 
-func generateJWT(userID uint) (string, error) {
+// generateJWT issues a short-lived access token for the given session.
+func generateJWT(userID, sessionID uint) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
+		"typ":     "access",
+		"iss":     keyring.Issuer(),
+		"aud":     keyring.AudienceAccess,
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+		"sid":     sessionID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(config.AccessTokenTTL).Unix(),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.JWTSecret))
-}
-
-// GoogleLogin redirects the client to Google’s OAuth consent page.
-func GoogleLogin(c *fiber.Ctx) error {
-	url := utils.GetGoogleOAuthURL()
-	return c.Redirect(url, fiber.StatusTemporaryRedirect)
-}
-
-// GoogleCallback handles the callback from Google OAuth.
-func GoogleCallback(c *fiber.Ctx) error {
-	code := c.Query("code")
-	if code == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Code not found"})
-	}
-
-	// Exchange the code for an access token and fetch user info.
-	userInfo, err := utils.GetGoogleUserInfo(code)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-	}
-
-	// Check if a user with this email exists.
-	var user models.User
-	if err := models.DB.Where("email = ?", userInfo.Email).First(&user).Error; err != nil {
-		// If not, create a new user with auto‑generated username.
-		username := utils.GenerateUsername(userInfo.Name)
-		user = models.User{
-			Email:          userInfo.Email,
-			Name:           userInfo.Name,
-			Username:       username,
-			ProfilePicture: userInfo.Picture,
-		}
-		models.DB.Create(&user)
-	}
-
-	token, err := generateJWT(user.ID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create token"})
-	}
-
-	return c.JSON(fiber.Map{"token": token, "user": user})
+	return keyring.Sign(claims)
 }
 
 // Logout godoc
 // @Summary Logout user
-// @Description Logs out the user by adding their token to a blacklist so it cannot be used further.
+// @Description Logs out the user by adding their token to a blacklist and revoking its session so neither the access nor the refresh token can be used further.
 // @Tags Auth
 // @Produce json
 // @Success 200 {object} AuthResponse
@@ -250,10 +323,9 @@ func Logout(c *fiber.Ctx) error {
 	}
 	tokenStr := authHeader[len(bearerPrefix):]
 
-	// Parse token to extract expiration (using the same secret).
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWTSecret), nil
-	})
+	// Parse token to extract expiration.
+	claims := jwt.MapClaims{}
+	token, err := keyring.ParseFor(tokenStr, claims, keyring.AudienceAccess)
 	if err != nil || !token.Valid {
 		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
 			Status:  "error",
@@ -261,13 +333,6 @@ func Logout(c *fiber.Ctx) error {
 		})
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
-			Status:  "error",
-			Message: "Invalid token claims",
-		})
-	}
 	expFloat, ok := claims["exp"].(float64)
 	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
@@ -278,7 +343,22 @@ func Logout(c *fiber.Ctx) error {
 	expirationTime := time.Unix(int64(expFloat), 0)
 
 	// Add token to blacklist.
-	blacklist.Add(tokenStr, expirationTime)
+	if err := blacklist.Add(tokenStr, expirationTime); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not revoke token",
+		})
+	}
+
+	// Revoke the session so its refresh token cannot mint new access tokens.
+	if sid, ok := claims["sid"].(float64); ok {
+		if err := revokeSession(uint(sid)); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Could not revoke session",
+			})
+		}
+	}
 
 	return c.JSON(AuthResponse{
 		Status:  "success",
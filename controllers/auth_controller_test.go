@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"socialmedia/keyring"
+	"socialmedia/models"
+	"socialmedia/services/loginguard"
+	"socialmedia/utils"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct horse battery"
+
+func newLoginTest(t *testing.T) (*fiber.App, loginguard.Config) {
+	t.Helper()
+	setupTestDB(t)
+	cfg := loginguard.DefaultConfig()
+	cfg.BaseDelay = 0
+	guard := loginguard.New(models.DB, cfg)
+
+	app := fiber.New()
+	app.Post("/api/login", Login(guard))
+	app.Post("/api/login/2fa", LoginTwoFactor(guard))
+	return app, cfg
+}
+
+func createLoginUser(t *testing.T, email string, twoFactor bool) models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return createTestUser(t, email, func(u *models.User) {
+		u.Password = string(hash)
+		if twoFactor {
+			u.TwoFactorEnabled = true
+			u.TOTPSecret, _ = utils.GenerateTOTPSecret()
+		}
+	})
+}
+
+func postJSON(t *testing.T, app *fiber.App, path string, body interface{}) (*http.Response, AuthResponse) {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	// Hashing a password takes a while; don't time out.
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out AuthResponse
+	decodeJSON(t, resp, &out)
+	return resp, out
+}
+
+func accountFailures(t *testing.T, email string) int {
+	t.Helper()
+	var throttle models.LoginThrottle
+	if err := models.DB.Where(map[string]interface{}{"key": "account:" + email}).Find(&throttle).Error; err != nil {
+		t.Fatal(err)
+	}
+	return throttle.Failures
+}
+
+// Knowing the password must not reset the count of wrong two-factor codes.
+func TestLoginPasswordThenWrongCodeLocksOut(t *testing.T) {
+	app, cfg := newLoginTest(t)
+	createLoginUser(t, "user@example.com", true)
+	credentials := LoginInput{Email: "user@example.com", Password: testPassword}
+
+	for i := 1; i <= cfg.MaxFailures; i++ {
+		resp, body := postJSON(t, app, "/api/login", credentials)
+		if resp.StatusCode != fiber.StatusOK || body.Status != "2fa_required" {
+			t.Fatalf("attempt %d: login = %d %+v", i, resp.StatusCode, body)
+		}
+		resp, _ = postJSON(t, app, "/api/login/2fa", TwoFactorLoginInput{ChallengeToken: body.ChallengeToken, Code: "wrong-code"})
+		if resp.StatusCode != fiber.StatusUnauthorized {
+			t.Fatalf("attempt %d: wrong code status = %d", i, resp.StatusCode)
+		}
+	}
+
+	resp, _ := postJSON(t, app, "/api/login", credentials)
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("login after %d wrong codes = %d, want %d", cfg.MaxFailures, resp.StatusCode, fiber.StatusTooManyRequests)
+	}
+}
+
+func TestLoginTwoFactorSuccessResetsFailures(t *testing.T) {
+	app, _ := newLoginTest(t)
+	user := createLoginUser(t, "user@example.com", true)
+	if err := models.DB.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: utils.HashToken("abcd1234")}).Error; err != nil {
+		t.Fatal(err)
+	}
+	credentials := LoginInput{Email: "user@example.com", Password: testPassword}
+
+	_, body := postJSON(t, app, "/api/login", credentials)
+	postJSON(t, app, "/api/login/2fa", TwoFactorLoginInput{ChallengeToken: body.ChallengeToken, Code: "wrong-code"})
+	postJSON(t, app, "/api/login/2fa", TwoFactorLoginInput{ChallengeToken: body.ChallengeToken, Code: "wrong-code"})
+
+	// The password alone leaves the failures in place.
+	_, body = postJSON(t, app, "/api/login", credentials)
+	if n := accountFailures(t, user.Email); n != 2 {
+		t.Fatalf("failures after password = %d, want 2", n)
+	}
+
+	resp, body := postJSON(t, app, "/api/login/2fa", TwoFactorLoginInput{ChallengeToken: body.ChallengeToken, Code: "ABCD-1234"})
+	if resp.StatusCode != fiber.StatusOK || body.Status != "success" {
+		t.Fatalf("valid code = %d %+v", resp.StatusCode, body)
+	}
+	if n := accountFailures(t, user.Email); n != 0 {
+		t.Errorf("failures after login = %d, want 0", n)
+	}
+}
+
+func TestLoginPasswordResetsFailures(t *testing.T) {
+	app, _ := newLoginTest(t)
+	user := createLoginUser(t, "user@example.com", false)
+
+	postJSON(t, app, "/api/login", LoginInput{Email: user.Email, Password: "wrong"})
+	if n := accountFailures(t, user.Email); n != 1 {
+		t.Fatalf("failures = %d, want 1", n)
+	}
+	resp, body := postJSON(t, app, "/api/login", LoginInput{Email: user.Email, Password: testPassword})
+	if resp.StatusCode != fiber.StatusOK || body.Status != "success" {
+		t.Fatalf("login = %d %+v", resp.StatusCode, body)
+	}
+	if n := accountFailures(t, user.Email); n != 0 {
+		t.Errorf("failures after login = %d, want 0", n)
+	}
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice@example.com")
+	session := models.Session{UserID: user.ID, RefreshTokenHash: "hash", LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := models.DB.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	app := newScopedApp()
+
+	token, err := generateJWT(user.ID, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := requestWithToken(t, app, http.MethodGet, "/api/sessions", token); status != fiber.StatusOK {
+		t.Fatalf("access token = %d, want 200", status)
+	}
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+	}{
+		{"no type", func(c jwt.MapClaims) { delete(c, "typ") }},
+		{"challenge type", func(c jwt.MapClaims) { c["typ"] = "2fa_challenge" }},
+		{"no issuer", func(c jwt.MapClaims) { delete(c, "iss") }},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://elsewhere.example.com" }},
+		{"no audience", func(c jwt.MapClaims) { delete(c, "aud") }},
+		{"challenge audience", func(c jwt.MapClaims) { c["aud"] = keyring.AudienceChallenge }},
+	}
+	for _, tt := range tests {
+		claims := jwt.MapClaims{}
+		if _, err := keyring.Parse(token, claims); err != nil {
+			t.Fatal(err)
+		}
+		tt.change(claims)
+		forged, err := keyring.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := requestWithToken(t, app, http.MethodGet, "/api/sessions", forged); status != fiber.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", tt.name, status)
+		}
+	}
+
+	// Neither kind of token passes for the other.
+	challenge, err := generateChallengeToken(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := requestWithToken(t, app, http.MethodGet, "/api/sessions", challenge); status != fiber.StatusUnauthorized {
+		t.Errorf("challenge token = %d, want 401", status)
+	}
+	if _, err := parseChallengeToken(token); err == nil {
+		t.Error("access token accepted as a challenge")
+	}
+	if id, err := parseChallengeToken(challenge); err != nil || id != user.ID {
+		t.Errorf("parseChallengeToken() = %d, %v", id, err)
+	}
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"errors"
+	"socialmedia/models"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errAlreadyBlocked = errors.New("already blocked")
+
+// checkNotBlocked responds with 403 and returns false if either user has
+// blocked the other.
+func checkNotBlocked(c *fiber.Ctx, userID, otherID uint) bool {
+	blocked, err := models.IsBlocked(models.DB, userID, otherID)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to check blocks"})
+		return false
+	}
+	if blocked {
+		c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: "You cannot interact with this user"})
+		return false
+	}
+	return true
+}
+
+// BlockUser godoc
+// @Summary Block a user
+// @Description Block a user. Follows in both directions are removed, neither of you can follow the other, and they can no longer see, like or comment on your posts.
+// @Tags User
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/{id}/block [post]
+// @Security ApiKeyAuth
+func BlockUser(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(uint)
+	target, ok := findTargetUser(c)
+	if !ok {
+		return nil
+	}
+	if target.ID == currentUserID {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot block yourself"})
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		block := models.Block{BlockerID: currentUserID, BlockedID: target.ID}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyBlocked
+		}
+
+		// Remove follows and follow requests in both directions, keeping the
+		// counters in step.
+		pairs := [][2]uint{{currentUserID, target.ID}, {target.ID, currentUserID}}
+		for _, pair := range pairs {
+			result := tx.Unscoped().
+				Where("follower_id = ? AND following_id = ?", pair[0], pair[1]).
+				Delete(&models.Follow{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				if err := adjustFollowCounts(tx, pair[0], pair[1], -1); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Where("(requester_id = ? AND target_id = ?) OR (requester_id = ? AND target_id = ?)",
+			currentUserID, target.ID, target.ID, currentUserID).
+			Delete(&models.FollowRequest{}).Error
+	})
+	if errors.Is(err, errAlreadyBlocked) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Already blocked"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to block user"})
+	}
+
+	return c.JSON(MessageResponse{Message: "User blocked"})
+}
+
+// UnblockUser godoc
+// @Summary Unblock a user
+// @Description Remove a block. Follows removed by the block are not restored.
+// @Tags User
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/{id}/block [delete]
+// @Security ApiKeyAuth
+func UnblockUser(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(uint)
+	return removeRelation(c, &models.Block{}, "blocker_id = ? AND blocked_id = ?", currentUserID, "Not blocked", "User unblocked")
+}
+
+// MuteUser godoc
+// @Summary Mute a user
+// @Description Hide a user's posts and comments from your timeline, post list and comment threads. They are not notified.
+// @Tags User
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/{id}/mute [post]
+// @Security ApiKeyAuth
+func MuteUser(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(uint)
+	target, ok := findTargetUser(c)
+	if !ok {
+		return nil
+	}
+	if target.ID == currentUserID {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot mute yourself"})
+	}
+
+	mute := models.Mute{MuterID: currentUserID, MutedID: target.ID}
+	result := models.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to mute user"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Already muted"})
+	}
+
+	return c.JSON(MessageResponse{Message: "User muted"})
+}
+
+// UnmuteUser godoc
+// @Summary Unmute a user
+// @Description Show a muted user's content again
+// @Tags User
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/{id}/mute [delete]
+// @Security ApiKeyAuth
+func UnmuteUser(c *fiber.Ctx) error {
+	currentUserID := c.Locals("user_id").(uint)
+	return removeRelation(c, &models.Mute{}, "muter_id = ? AND muted_id = ?", currentUserID, "Not muted", "User unmuted")
+}
+
+// removeRelation deletes the caller's block or mute of the user named by the
+// :id parameter.
+func removeRelation(c *fiber.Ctx, model interface{}, query string, currentUserID uint, notFound, message string) error {
+	targetID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID"})
+	}
+
+	result := models.DB.Where(query, currentUserID, targetID).Delete(model)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update user"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: notFound})
+	}
+	return c.JSON(MessageResponse{Message: message})
+}
+
+// ListBlocks godoc
+// @Summary List blocked users
+// @Description Get a page of the users you have blocked, most recent first
+// @Tags User
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Users per page (default: 20, max 100)"
+// @Success 200 {object} UserListResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/blocks [get]
+// @Security ApiKeyAuth
+func ListBlocks(c *fiber.Ctx) error {
+	return listRelatedUsers(c, "blocks", "blocks.blocker_id", "blocks.blocked_id")
+}
+
+// ListMutes godoc
+// @Summary List muted users
+// @Description Get a page of the users you have muted, most recent first
+// @Tags User
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Users per page (default: 20, max 100)"
+// @Success 200 {object} UserListResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/mutes [get]
+// @Security ApiKeyAuth
+func ListMutes(c *fiber.Ctx) error {
+	return listRelatedUsers(c, "mutes", "mutes.muter_id", "mutes.muted_id")
+}
+
+// listRelatedUsers responds with a page of the users the caller has a row
+// for in table, where ownerColumn holds the caller and userColumn the user.
+func listRelatedUsers(c *fiber.Ctx, table, ownerColumn, userColumn string) error {
+	currentUserID := c.Locals("user_id").(uint)
+	page, limit := pageParams(c, 20)
+
+	query := models.DB.Model(&models.User{}).
+		Joins("JOIN "+table+" ON "+userColumn+" = users.id").
+		Where(ownerColumn+" = ?", currentUserID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to count users"})
+	}
+
+	var users []models.User
+	if err := query.Select("users.*").Order(table + ".created_at desc").
+		Limit(limit).Offset((page - 1) * limit).
+		Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch users"})
+	}
+
+	response := make([]UserSummaryResponse, len(users))
+	for i, u := range users {
+		response[i] = UserSummaryResponse{
+			ID:             u.ID,
+			Name:           u.Name,
+			Username:       u.Username,
+			ProfilePicture: u.ProfilePicture,
+			Bio:            u.Bio,
+		}
+	}
+	return c.JSON(UserListResponse{
+		Users:    response,
+		Metadata: newPaginationMetadata(total, page, limit),
+	})
+}
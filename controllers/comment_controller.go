@@ -23,6 +23,29 @@ type PaginationMetadata struct {
 	TotalPages int64 `json:"total_pages"`
 }
 
+// pageParams reads the page and limit query parameters, falling back to the
+// first page and defaultLimit. Limits above 100 are not allowed.
+func pageParams(c *fiber.Ctx, defaultLimit int) (page, limit int) {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err = strconv.Atoi(c.Query("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = defaultLimit
+	}
+	return page, limit
+}
+
+func newPaginationMetadata(total int64, page, limit int) PaginationMetadata {
+	return PaginationMetadata{
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: (total + int64(limit) - 1) / int64(limit),
+	}
+}
+
 // SingleCommentResponse represents the response for a single comment
 type SingleCommentResponse struct {
 	Comment       models.Comment  `json:"comment"`
@@ -60,6 +83,16 @@ func AddComment(c *fiber.Ctx) error {
 		})
 	}
 
+	var post models.Post
+	if err := models.DB.First(&post, postID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(MessageResponse{
+			Message: "Post not found",
+		})
+	}
+	if !checkNotBlocked(c, userID, post.UserID) || !checkCanSeeContent(c, userID, post.UserID) {
+		return nil
+	}
+
 	// Start a transaction
 	tx := models.DB.Begin()
 
@@ -80,7 +113,7 @@ func AddComment(c *fiber.Ctx) error {
 	// Increment the comment count in the post table
 	if err := tx.Model(&models.Post{}).
 		Where("id = ?", postID).
-		UpdateColumn("comment_count", gorm.Expr("comment_count + ?", 1)).
+		UpdateColumn("comments_count", gorm.Expr("comments_count + ?", 1)).
 		Error; err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(MessageResponse{
@@ -185,73 +218,39 @@ func DeleteComment(c *fiber.Ctx) error {
 		})
 	}
 
-	// Start a transaction
-	tx := models.DB.Begin()
-
-	// Delete the comment
-	if err := tx.Delete(&comment).Error; err != nil {
-		tx.Rollback()
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteComment(tx, comment)
+	}); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(MessageResponse{
 			Message: "Failed to delete comment",
 		})
 	}
 
-	// Decrement the comment count in the post table
-	if err := tx.Model(&models.Post{}).
-		Where("id = ?", comment.PostID).
-		UpdateColumn("comment_count", gorm.Expr("GREATEST(comment_count - ?, 0)", 1)).
-		Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).JSON(MessageResponse{
-			Message: "Failed to update comment count",
-		})
-	}
+	return c.JSON(MessageResponse{
+		Message: "Comment deleted",
+	})
+}
 
-	// If this was a parent comment, also delete all replies
+// deleteComment deletes a comment together with its replies and keeps the
+// post's comment count in step.
+func deleteComment(tx *gorm.DB, comment models.Comment) error {
+	deleted := int64(1)
 	if comment.ParentCommentID == nil {
-		// Delete all replies and update the comment count accordingly
-		var replyCount int64
-		if err := tx.Model(&models.Comment{}).
-			Where("parent_id = ?", comment.ID).
-			Count(&replyCount).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(MessageResponse{
-				Message: "Failed to count replies",
-			})
-		}
-
-		if replyCount > 0 {
-			// Delete all replies
-			if err := tx.Where("parent_id = ?", comment.ID).Delete(&models.Comment{}).Error; err != nil {
-				tx.Rollback()
-				return c.Status(fiber.StatusInternalServerError).JSON(MessageResponse{
-					Message: "Failed to delete replies",
-				})
-			}
-
-			// Decrease the comment count by the number of replies
-			if err := tx.Model(&models.Post{}).
-				Where("id = ?", comment.PostID).
-				UpdateColumn("comment_count", gorm.Expr("GREATEST(comment_count - ?, 0)", replyCount)).
-				Error; err != nil {
-				tx.Rollback()
-				return c.Status(fiber.StatusInternalServerError).JSON(MessageResponse{
-					Message: "Failed to update comment count for replies",
-				})
-			}
+		result := tx.Where("parent_comment_id = ?", comment.ID).Delete(&models.Comment{})
+		if result.Error != nil {
+			return result.Error
 		}
+		deleted += result.RowsAffected
 	}
 
-	// Commit the transaction
-	if err := tx.Commit().Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(MessageResponse{
-			Message: "Failed to commit transaction",
-		})
+	if err := tx.Delete(&comment).Error; err != nil {
+		return err
 	}
 
-	return c.JSON(MessageResponse{
-		Message: "Comment deleted",
-	})
+	return tx.Model(&models.Post{}).
+		Where("id = ?", comment.PostID).
+		UpdateColumn("comments_count", gorm.Expr("CASE WHEN comments_count > ? THEN comments_count - ? ELSE 0 END", deleted, deleted)).
+		Error
 }
 
 // AddReply godoc
@@ -287,6 +286,19 @@ func AddReply(c *fiber.Ctx) error {
 	// Get the authenticated user ID.
 	userID := c.Locals("user_id").(uint)
 
+	// Neither the post's author nor the parent comment's author may have a
+	// block with the replier.
+	var post models.Post
+	if err := models.DB.First(&post, parentComment.PostID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(MessageResponse{
+			Message: "Post not found",
+		})
+	}
+	if !checkNotBlocked(c, userID, post.UserID) || !checkNotBlocked(c, userID, parentComment.UserID) ||
+		!checkCanSeeContent(c, userID, post.UserID) {
+		return nil
+	}
+
 	// Parse the request body.
 	type Request struct {
 		Content string `json:"content"`
@@ -334,6 +346,8 @@ func AddReply(c *fiber.Ctx) error {
 // @Failure 404 {object} MessageResponse
 // @Router /posts/{id}/comments [get]
 func GetCommentsByPostID(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
 	// Get post ID from URL parameters
 	postID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -355,20 +369,35 @@ func GetCommentsByPostID(c *fiber.Ctx) error {
 
 	offset := (page - 1) * limit
 
-	// Check if post exists
+	// Check if post exists and the caller may see it
 	var post models.Post
 	if err := models.DB.First(&post, postID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(MessageResponse{
 			Message: "Post not found",
 		})
 	}
+	if blocked, err := models.HasBlocked(models.DB, post.UserID, userID); err != nil || blocked {
+		return c.Status(fiber.StatusNotFound).JSON(MessageResponse{
+			Message: "Post not found",
+		})
+	}
+	if !checkCanSeeContent(c, userID, post.UserID) {
+		return nil
+	}
+
+	// Leave out comments by users the caller has blocked, been blocked by or
+	// muted, and by private users the caller does not follow.
+	visible := func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(models.HideBlockedAndMuted(userID, "user_id"), models.HidePrivate(userID, "user_id"))
+	}
 
 	var comments []models.Comment
 	var total int64
 
 	// Get total count of parent comments (comments without ParentID)
 	if err := models.DB.Model(&models.Comment{}).
-		Where("post_id = ? AND parent_id IS NULL", postID).
+		Scopes(visible).
+		Where("post_id = ? AND parent_comment_id IS NULL", postID).
 		Count(&total).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(MessageResponse{
 			Message: "Failed to count comments",
@@ -377,10 +406,11 @@ func GetCommentsByPostID(c *fiber.Ctx) error {
 
 	// Get paginated parent comments with their replies and user information
 	if err := models.DB.
-		Preload("User").         // Load comment author
-		Preload("Replies").      // Load replies
-		Preload("Replies.User"). // Load reply authors
-		Where("post_id = ? AND parent_id IS NULL", postID).
+		Scopes(visible).
+		Preload("User").             // Load comment author
+		Preload("Replies", visible). // Load replies
+		Preload("Replies.User").     // Load reply authors
+		Where("post_id = ? AND parent_comment_id IS NULL", postID).
 		Order("created_at desc").
 		Limit(limit).
 		Offset(offset).
@@ -413,6 +443,8 @@ func GetCommentsByPostID(c *fiber.Ctx) error {
 // @Failure 404 {object} MessageResponse
 // @Router /comments/{id} [get]
 func GetCommentByID(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
 	// Get comment ID from URL parameters
 	commentID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -434,6 +466,22 @@ func GetCommentByID(c *fiber.Ctx) error {
 		})
 	}
 
+	// Comments on the posts of someone who blocked the caller are hidden.
+	var post models.Post
+	if err := models.DB.First(&post, comment.PostID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(MessageResponse{
+			Message: "Comment not found",
+		})
+	}
+	if blocked, err := models.HasBlocked(models.DB, post.UserID, userID); err != nil || blocked {
+		return c.Status(fiber.StatusNotFound).JSON(MessageResponse{
+			Message: "Comment not found",
+		})
+	}
+	if !checkCanSeeContent(c, userID, post.UserID) || !checkCanSeeContent(c, userID, comment.UserID) {
+		return nil
+	}
+
 	// If this is a reply (has ParentID), get the parent comment
 	if comment.ParentCommentID != nil {
 		var parentComment models.Comment
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"errors"
+	"socialmedia/models"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errRequestNotFound = errors.New("follow request not found")
+
+// FollowRequestResponse is a pending request to follow the caller.
+type FollowRequestResponse struct {
+	ID        uint                `json:"id"`
+	User      UserSummaryResponse `json:"user"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// FollowRequestListResponse is a page of follow requests.
+type FollowRequestListResponse struct {
+	Requests []FollowRequestResponse `json:"requests"`
+	Metadata PaginationMetadata      `json:"metadata"`
+}
+
+// checkCanSeeContent responds with 403 and returns false if the caller may
+// not see ownerID's content because ownerID is private.
+func checkCanSeeContent(c *fiber.Ctx, viewerID, ownerID uint) bool {
+	allowed, err := models.CanSeeContent(models.DB, viewerID, ownerID)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to check privacy"})
+		return false
+	}
+	if !allowed {
+		c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: "This account is private"})
+		return false
+	}
+	return true
+}
+
+// approveFollowRequest turns a follow request into a follow.
+func approveFollowRequest(tx *gorm.DB, request models.FollowRequest) error {
+	if err := tx.Delete(&request).Error; err != nil {
+		return err
+	}
+	follow := models.Follow{FollowerID: request.RequesterID, FollowingID: request.TargetID}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return adjustFollowCounts(tx, request.RequesterID, request.TargetID, 1)
+}
+
+// ListFollowRequests godoc
+// @Summary List follow requests
+// @Description Get a page of the pending requests to follow you, oldest first
+// @Tags User
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Requests per page (default: 20, max 100)"
+// @Success 200 {object} FollowRequestListResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/follow-requests [get]
+// @Security ApiKeyAuth
+func ListFollowRequests(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	page, limit := pageParams(c, 20)
+
+	query := models.DB.Model(&models.FollowRequest{}).Where("target_id = ?", userID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to count follow requests"})
+	}
+
+	var requests []models.FollowRequest
+	if err := query.Order("created_at asc").Limit(limit).Offset((page - 1) * limit).Find(&requests).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch follow requests"})
+	}
+
+	ids := make([]uint, len(requests))
+	for i, r := range requests {
+		ids[i] = r.RequesterID
+	}
+	var users []models.User
+	if len(ids) > 0 {
+		if err := models.DB.Where("id IN ?", ids).Find(&users).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch follow requests"})
+		}
+	}
+	byID := make(map[uint]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	following, _, err := followRelations(userID, ids)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch follow requests"})
+	}
+
+	response := make([]FollowRequestResponse, 0, len(requests))
+	for _, r := range requests {
+		u, ok := byID[r.RequesterID]
+		if !ok {
+			continue
+		}
+		response = append(response, FollowRequestResponse{
+			ID: r.ID,
+			User: UserSummaryResponse{
+				ID:             u.ID,
+				Name:           u.Name,
+				Username:       u.Username,
+				ProfilePicture: u.ProfilePicture,
+				Bio:            u.Bio,
+				IsFollowing:    following[u.ID],
+			},
+			CreatedAt: r.CreatedAt,
+		})
+	}
+	return c.JSON(FollowRequestListResponse{
+		Requests: response,
+		Metadata: newPaginationMetadata(total, page, limit),
+	})
+}
+
+// ApproveFollowRequest godoc
+// @Summary Approve a follow request
+// @Description Let the requester follow you
+// @Tags User
+// @Produce json
+// @Param id path int true "Follow request ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/follow-requests/{id}/approve [post]
+// @Security ApiKeyAuth
+func ApproveFollowRequest(c *fiber.Ctx) error {
+	return resolveFollowRequest(c, approveFollowRequest, "Follow request approved")
+}
+
+// RejectFollowRequest godoc
+// @Summary Reject a follow request
+// @Description Decline a request to follow you. The requester is not notified.
+// @Tags User
+// @Produce json
+// @Param id path int true "Follow request ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/follow-requests/{id}/reject [post]
+// @Security ApiKeyAuth
+func RejectFollowRequest(c *fiber.Ctx) error {
+	reject := func(tx *gorm.DB, request models.FollowRequest) error {
+		return tx.Delete(&request).Error
+	}
+	return resolveFollowRequest(c, reject, "Follow request rejected")
+}
+
+// resolveFollowRequest applies resolve to the caller's incoming follow
+// request named by the :id parameter.
+func resolveFollowRequest(c *fiber.Ctx, resolve func(*gorm.DB, models.FollowRequest) error, message string) error {
+	userID := c.Locals("user_id").(uint)
+	requestID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid follow request ID"})
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		var request models.FollowRequest
+		if err := tx.Where("id = ? AND target_id = ?", requestID, userID).First(&request).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errRequestNotFound
+			}
+			return err
+		}
+		return resolve(tx, request)
+	})
+	if errors.Is(err, errRequestNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Follow request not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update follow request"})
+	}
+	return c.JSON(MessageResponse{Message: message})
+}
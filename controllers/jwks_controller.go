@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"socialmedia/keyring"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying the access tokens this server issues. Tokens name their key in the "kid" header.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} keyring.JWKSet
+// @Router /.well-known/jwks.json [get]
+func JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(keyring.JWKS())
+}
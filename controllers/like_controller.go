@@ -42,6 +42,10 @@ func LikePost(c *fiber.Ctx) error {
 		tx.Rollback()
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
 	}
+	if !checkNotBlocked(c, userID, post.UserID) || !checkCanSeeContent(c, userID, post.UserID) {
+		tx.Rollback()
+		return nil
+	}
 
 	// Check if the post has already been liked by this user
 	var like models.Like
@@ -63,7 +67,7 @@ func LikePost(c *fiber.Ctx) error {
 	}
 
 	// Increment like count
-	if err := tx.Model(&post).Update("likes_count", gorm.Expr("likes_count + ?", 1)).Error; err != nil {
+	if err := tx.Model(&post).UpdateColumn("like_count", gorm.Expr("like_count + ?", 1)).Error; err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update like count"})
 	}
@@ -123,7 +127,7 @@ func UnlikePost(c *fiber.Ctx) error {
 	}
 
 	// Decrement like count, ensure it doesn't go below 0
-	if err := tx.Model(&post).Update("likes_count", gorm.Expr("GREATEST(likes_count - ?, 0)", 1)).Error; err != nil {
+	if err := tx.Model(&post).UpdateColumn("like_count", gorm.Expr("CASE WHEN like_count > ? THEN like_count - ? ELSE 0 END", 1, 1)).Error; err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update like count"})
 	}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"socialmedia/config"
+	"socialmedia/keyring"
+	"socialmedia/mailer"
+	"socialmedia/models"
+	"socialmedia/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// magicLinkResendInterval limits how often a link can be emailed to the same
+// address.
+const magicLinkResendInterval = time.Minute
+
+type MagicLinkInput struct {
+	Email string `json:"email"`
+}
+
+// magicLinkClaims is the payload of a magic link token.
+type magicLinkClaims struct {
+	jwt.RegisteredClaims
+	Type  string `json:"typ"`
+	Email string `json:"email"`
+}
+
+// RequestMagicLink godoc
+// @Summary Request a magic login link
+// @Description Email a single-use link that logs the user in without a password. An account is created on first use. The response is the same whether or not the email is registered.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param magicLinkInput body MagicLinkInput true "Email address"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} AuthResponse
+// @Failure 500 {object} AuthResponse
+// @Router /api/login/magic [post]
+func RequestMagicLink(c *fiber.Ctx) error {
+	var input MagicLinkInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Invalid request payload",
+		})
+	}
+	address, err := mail.ParseAddress(strings.TrimSpace(input.Email))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "A valid email address is required",
+		})
+	}
+	email := strings.ToLower(address.Address)
+
+	response := AuthResponse{
+		Status:  "success",
+		Message: "Check your email for a login link",
+	}
+
+	// Don't let the endpoint be used to flood an inbox.
+	now := time.Now()
+	var recent int64
+	if err := models.DB.Model(&models.MagicLink{}).
+		Where("email = ? AND created_at > ?", email, now.Add(-magicLinkResendInterval)).
+		Count(&recent).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not create login link",
+		})
+	}
+	if recent > 0 {
+		return c.JSON(response)
+	}
+
+	jti, err := utils.GenerateSecureToken(24)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not create login link",
+		})
+	}
+	expiresAt := now.Add(config.MagicLinkTTL)
+	token, err := keyring.Sign(magicLinkClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    keyring.Issuer(),
+			Audience:  jwt.ClaimStrings{keyring.AudienceMagicLink},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Type:  "magic_link",
+		Email: email,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not create login link",
+		})
+	}
+
+	if err := models.DB.Create(&models.MagicLink{
+		JTI:       jti,
+		Email:     email,
+		IP:        c.IP(),
+		ExpiresAt: expiresAt,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not create login link",
+		})
+	}
+
+	link := fmt.Sprintf("%s/login/magic?token=%s", config.AppURL, token)
+	mailer.SendAsync(mailer.Message{
+		To:      email,
+		Subject: "Your " + config.AppName + " login link",
+		Body: fmt.Sprintf("Hi,\n\nOpen the link below to log in to %s. It expires in %s and can only be used once.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.",
+			config.AppName, config.MagicLinkTTL, link),
+	})
+
+	return c.JSON(response)
+}
+
+// VerifyMagicLink godoc
+// @Summary Log in with a magic link
+// @Description Exchange a magic link token for an access token and refresh token, creating the account on first use. Accounts with two-factor authentication get a 2fa_required challenge instead.
+// @Tags Auth
+// @Produce json
+// @Param token query string true "Magic link token"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} AuthResponse
+// @Failure 403 {object} AuthResponse
+// @Failure 500 {object} AuthResponse
+// @Router /api/login/magic/verify [get]
+func VerifyMagicLink(c *fiber.Ctx) error {
+	invalid := func() error {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Invalid or expired login link",
+		})
+	}
+
+	var claims magicLinkClaims
+	token, err := keyring.ParseFor(c.Query("token"), &claims, keyring.AudienceMagicLink)
+	if err != nil || !token.Valid || claims.Type != "magic_link" || claims.ID == "" || claims.Email == "" {
+		return invalid()
+	}
+
+	// Claim the link so it cannot be used twice.
+	now := time.Now()
+	result := models.DB.Model(&models.MagicLink{}).
+		Where("jti = ? AND email = ? AND used_at IS NULL AND expires_at > ?", claims.ID, claims.Email, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not verify login link",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return invalid()
+	}
+
+	var user models.User
+	err = models.DB.Where("LOWER(email) = ?", claims.Email).First(&user).Error
+	switch {
+	case err == nil:
+		// Following the link proves the user owns the address.
+		if user.EmailVerifiedAt == nil {
+			if err := models.DB.Model(&user).Update("email_verified_at", now).Error; err != nil {
+				log.Printf("Could not mark email of user %d verified: %v", user.ID, err)
+			}
+		}
+		return beginLogin(c, user)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		name := strings.SplitN(claims.Email, "@", 2)[0]
+		user = models.User{
+			Email:           claims.Email,
+			Name:            name,
+			Username:        utils.GenerateUsername(name),
+			EmailVerifiedAt: &now,
+		}
+		if err := models.DB.Create(&user).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Failed to create user",
+			})
+		}
+		return completeLogin(c, user)
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not verify login link",
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"socialmedia/config"
+	"socialmedia/internal/testutil"
+	"socialmedia/keyring"
+	"socialmedia/models"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("APP_ENV", "development")
+	log.SetOutput(io.Discard)
+	config.InitConfig()
+	if err := keyring.Configure(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// setupTestDB points models.DB at a fresh migrated database for the test.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	models.DB = testutil.NewDB(t)
+}
+
+// createTestUser stores a user with the given email.
+func createTestUser(t *testing.T, email string, configure ...func(*models.User)) models.User {
+	t.Helper()
+	user := models.User{Email: email, Name: "Test", Username: email}
+	for _, f := range configure {
+		f(&user)
+	}
+	if err := models.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// asUser stands in for the session middleware, authenticating every request
+// as user.
+func asUser(user models.User) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals("user_id", user.ID)
+		c.Locals("user", user)
+		return c.Next()
+	}
+}
+
+// decodeJSON reads a JSON response body into v.
+func decodeJSON(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,514 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"path"
+	"socialmedia/config"
+	"socialmedia/models"
+	"socialmedia/services"
+	"socialmedia/services/imaging"
+	"socialmedia/services/storage"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPostMedia is how many attachments a post can carry.
+const maxPostMedia = 10
+
+// maxAltTextLength is the longest alt text we keep, in characters.
+const maxAltTextLength = 255
+
+var (
+	errInvalidMedia     = errors.New("invalid media")
+	errTooManyMedia     = errors.New("too many attachments")
+	errAltTextTooLong   = errors.New("alt text too long")
+	errInvalidImageURL  = errors.New("invalid image URL")
+	errUnsupportedMedia = errors.New("unsupported media type")
+	errImageTooLarge    = errors.New("image dimensions are too large")
+	errFileTooLarge     = errors.New("file too large")
+	errTooManyFiles     = errors.New("too many files")
+	errQuotaExceeded    = errors.New("storage quota exceeded")
+	// errSaveMedia wraps failures to store an upload or record media.
+	errSaveMedia = errors.New("failed to save media")
+)
+
+// MediaInput names an attachment of a post: media uploaded earlier, with
+// optional alt text. Leaving AltText out keeps the media's current alt text.
+type MediaInput struct {
+	ID      uint    `json:"id"`
+	AltText *string `json:"alt_text,omitempty"`
+}
+
+// mediaErrorMessage returns the message to respond with, alongside a 400,
+// for the validation errors parsePostInput and attachMedia report, or "" for
+// any other error.
+func mediaErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errInvalidMedia):
+		return "Unknown media or media already attached to another post"
+	case errors.Is(err, errTooManyMedia):
+		return fmt.Sprintf("A post can have at most %d attachments", maxPostMedia)
+	case errors.Is(err, errAltTextTooLong):
+		return fmt.Sprintf("Alt text can be at most %d characters", maxAltTextLength)
+	case errors.Is(err, errInvalidImageURL):
+		return "Image URLs must be http or https URLs"
+	case errors.Is(err, errUnsupportedMedia):
+		return "Only these types of file can be uploaded: " + strings.Join(config.UploadAllowedTypes, ", ")
+	case errors.Is(err, errImageTooLarge):
+		return "Image dimensions are too large"
+	case errors.Is(err, errFileTooLarge):
+		return fmt.Sprintf("Files can be at most %d bytes", config.MaxUploadSize)
+	case errors.Is(err, errTooManyFiles):
+		return fmt.Sprintf("At most %d files can be uploaded at once", config.MaxUploadFiles)
+	case errors.Is(err, errQuotaExceeded):
+		return "Storage quota exceeded; remove some media to upload more"
+	}
+	return ""
+}
+
+// mediaErrorStatus returns the status to respond with for an error that
+// mediaErrorMessage has a message for.
+func mediaErrorStatus(err error) int {
+	if errors.Is(err, errFileTooLarge) || errors.Is(err, errTooManyFiles) || errors.Is(err, errQuotaExceeded) {
+		return fiber.StatusRequestEntityTooLarge
+	}
+	return fiber.StatusBadRequest
+}
+
+// postInputError responds to an error from parsePostInput.
+func postInputError(c *fiber.Ctx, err error) error {
+	if msg := mediaErrorMessage(err); msg != "" {
+		return c.Status(mediaErrorStatus(err)).JSON(ErrorResponse{Error: msg})
+	}
+	if errors.Is(err, errSaveMedia) {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to upload media"})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+}
+
+// isAllowedUpload reports whether files of the sniffed contentType can be
+// uploaded.
+func isAllowedUpload(contentType string) bool {
+	for _, allowed := range config.UploadAllowedTypes {
+		if contentType == allowed {
+			return services.IsAttachable(contentType)
+		}
+	}
+	return false
+}
+
+// saveMedia stores an upload and creates media for it in tx. media must
+// have UserID set; the rest of what describes the stored file is filled
+// in. All of r is read into memory and what is stored is written as new
+// objects, even when r is itself read from storage, as it is for a direct
+// upload. Files are checked against the upload limits by their size and their
+// first bytes. A file identical to one already stored is shared with it
+// rather than stored again. The stored size is charged to the uploader's
+// quota either way. The objects are stored straight away, so saveMedia
+// returns their keys for the caller to delete if tx does not commit; when
+// saveMedia itself fails it deletes them and returns none.
+func saveMedia(ctx context.Context, tx *gorm.DB, media *models.Media, r io.Reader) (stored []string, err error) {
+	data, err := io.ReadAll(io.LimitReader(r, config.MaxUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errSaveMedia, err)
+	}
+	if int64(len(data)) > config.MaxUploadSize {
+		return nil, errFileTooLarge
+	}
+	contentType := storage.DetectContentType(data)
+	if !isAllowedUpload(contentType) {
+		return nil, errUnsupportedMedia
+	}
+
+	defer func() {
+		if err != nil {
+			storage.DeleteAll(ctx, stored)
+			stored = nil
+		}
+	}()
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	var blob models.Blob
+	err = tx.Where("hash = ?", hash).First(&blob).Error
+	switch {
+	case err == nil:
+		if err := reuseBlob(tx, media, blob); err != nil {
+			return stored, err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		stored, err = storeFile(ctx, media, data, contentType)
+		if err != nil {
+			return stored, err
+		}
+		blob = models.Blob{Hash: hash, Size: media.Size}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&blob)
+		if result.Error != nil {
+			return stored, fmt.Errorf("%w: %v", errSaveMedia, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			// A concurrent upload of the same file got there first; share
+			// its copy and drop ours.
+			storage.DeleteAll(ctx, stored)
+			stored = nil
+			blob = models.Blob{}
+			if err := tx.Where("hash = ?", hash).First(&blob).Error; err != nil {
+				return stored, fmt.Errorf("%w: %v", errSaveMedia, err)
+			}
+			if err := reuseBlob(tx, media, blob); err != nil {
+				return stored, err
+			}
+		}
+	default:
+		return stored, fmt.Errorf("%w: %v", errSaveMedia, err)
+	}
+
+	charge := tx.Model(&models.User{}).Where("id = ?", media.UserID)
+	if config.UserStorageQuota > 0 {
+		charge = charge.Where("storage_used + ? <= ?", media.Size, config.UserStorageQuota)
+	}
+	result := charge.UpdateColumn("storage_used", gorm.Expr("storage_used + ?", media.Size))
+	if result.Error != nil {
+		return stored, fmt.Errorf("%w: %v", errSaveMedia, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return stored, errQuotaExceeded
+	}
+
+	if err := tx.Model(&blob).UpdateColumn("ref_count", gorm.Expr("ref_count + 1")).Error; err != nil {
+		return stored, fmt.Errorf("%w: %v", errSaveMedia, err)
+	}
+	media.BlobID = &blob.ID
+	if err := tx.Create(media).Error; err != nil {
+		return stored, fmt.Errorf("%w: %v", errSaveMedia, err)
+	}
+	return stored, nil
+}
+
+// reuseBlob fills in media to share the files stored for blob with the
+// media already made from it.
+func reuseBlob(tx *gorm.DB, media *models.Media, blob models.Blob) error {
+	var existing models.Media
+	if err := tx.Preload("Variants").Where("blob_id = ?", blob.ID).First(&existing).Error; err != nil {
+		return fmt.Errorf("%w: %v", errSaveMedia, err)
+	}
+	media.Type, media.URL, media.StorageKey = existing.Type, existing.URL, existing.StorageKey
+	media.Width, media.Height, media.Blurhash = existing.Width, existing.Height, existing.Blurhash
+	media.Variants = nil
+	for _, v := range existing.Variants {
+		v.ID, v.MediaID = 0, 0
+		media.Variants = append(media.Variants, v)
+	}
+	media.Size = blob.Size
+	return nil
+}
+
+// storeFile puts an upload of the given sniffed content type on the storage
+// backend and fills in media to describe it. Images are processed first:
+// the stored original is stripped of metadata, and resized variants and a
+// blurhash are recorded alongside it. Videos are stored as they are. It
+// returns the keys of the objects stored, even if it fails part way.
+func storeFile(ctx context.Context, media *models.Media, data []byte, contentType string) ([]string, error) {
+	mediaType, _ := services.DetermineMediaType(contentType)
+	if mediaType == models.VideoType {
+		obj, _, err := storage.Upload(ctx, "media", bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errSaveMedia, err)
+		}
+		media.Type, media.URL, media.StorageKey = mediaType, obj.URL, obj.Key
+		media.Size = int64(len(data))
+		return []string{obj.Key}, nil
+	}
+
+	processed, err := imaging.Process(bytes.NewReader(data))
+	if errors.Is(err, imaging.ErrUnsupportedFormat) {
+		return nil, errUnsupportedMedia
+	}
+	if errors.Is(err, imaging.ErrTooLarge) {
+		return nil, errImageTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errSaveMedia, err)
+	}
+
+	var stored []string
+	put := func(v imaging.Variant) (storage.Object, error) {
+		obj, _, err := storage.Upload(ctx, "media", bytes.NewReader(v.Data), int64(len(v.Data)))
+		if err != nil {
+			return obj, fmt.Errorf("%w: %v", errSaveMedia, err)
+		}
+		stored = append(stored, obj.Key)
+		media.Size += int64(len(v.Data))
+		return obj, nil
+	}
+
+	obj, err := put(processed.Original)
+	if err != nil {
+		return stored, err
+	}
+	// A static GIF comes back as a PNG and is no longer a gif.
+	media.Type, _ = services.DetermineMediaType(processed.Original.ContentType)
+	media.URL, media.StorageKey = obj.URL, obj.Key
+	media.Width, media.Height = processed.Original.Width, processed.Original.Height
+	media.Blurhash = processed.Blurhash
+	for _, thumb := range processed.Thumbnails {
+		obj, err := put(thumb)
+		if err != nil {
+			return stored, err
+		}
+		media.Variants = append(media.Variants, models.MediaVariant{
+			Name:       thumb.Name,
+			URL:        obj.URL,
+			StorageKey: obj.Key,
+			Width:      thumb.Width,
+			Height:     thumb.Height,
+		})
+	}
+	return stored, nil
+}
+
+// uploadMedia stores file and records it as media owned by userID that is
+// not attached to a post yet.
+func uploadMedia(ctx context.Context, userID uint, file *multipart.FileHeader, altText string) (models.Media, error) {
+	media := models.Media{UserID: userID, AltText: altText}
+	if utf8.RuneCountInString(altText) > maxAltTextLength {
+		return media, errAltTextTooLong
+	}
+	if file.Size > config.MaxUploadSize {
+		return media, errFileTooLarge
+	}
+	src, err := file.Open()
+	if err != nil {
+		return media, fmt.Errorf("%w: %v", errSaveMedia, err)
+	}
+	defer src.Close()
+
+	var stored []string
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		stored, err = saveMedia(ctx, tx, &media, src)
+		return err
+	})
+	if err != nil {
+		storage.DeleteAll(ctx, stored)
+	}
+	return media, err
+}
+
+// mediaFromURLs records image URLs as unattached media owned by userID.
+func mediaFromURLs(userID uint, urls []string) ([]MediaInput, error) {
+	inputs := make([]MediaInput, 0, len(urls))
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errInvalidImageURL
+		}
+		media := models.Media{UserID: userID, URL: raw, Type: models.ImageType}
+		if err := models.DB.Create(&media).Error; err != nil {
+			return nil, fmt.Errorf("%w: %v", errSaveMedia, err)
+		}
+		inputs = append(inputs, MediaInput{ID: media.ID})
+	}
+	return inputs, nil
+}
+
+// parsePostInput reads a post from either a JSON body or a multipart form.
+// Forms carry "content", "media_ids" (repeated, in order; an empty value
+// stands for no media) and "files" (repeated) with a parallel "alt_text" for
+// each file. input.Media is nil unless the request lists media. Uploaded
+// files and image URLs become new media, returned in added to go after the
+// listed ones.
+func parsePostInput(c *fiber.Ctx, userID uint) (input PostInput, added []MediaInput, err error) {
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		if err := c.BodyParser(&input); err != nil {
+			return input, nil, err
+		}
+	} else {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return input, nil, err
+		}
+		input.Content = c.FormValue("content")
+		if ids, ok := form.Value["media_ids"]; ok {
+			input.Media = []MediaInput{}
+			for _, s := range ids {
+				if s == "" {
+					continue
+				}
+				id, err := strconv.ParseUint(s, 10, 64)
+				if err != nil {
+					return input, nil, errInvalidMedia
+				}
+				input.Media = append(input.Media, MediaInput{ID: uint(id)})
+			}
+		}
+		files := form.File["files"]
+		if len(files) > config.MaxUploadFiles {
+			return input, nil, errTooManyFiles
+		}
+		if len(input.Media)+len(files) > maxPostMedia {
+			return input, nil, errTooManyMedia
+		}
+		altTexts := form.Value["alt_text"]
+		for i, file := range files {
+			altText := ""
+			if i < len(altTexts) {
+				altText = strings.TrimSpace(altTexts[i])
+			}
+			media, err := uploadMedia(c.UserContext(), userID, file, altText)
+			if err != nil {
+				return input, nil, err
+			}
+			added = append(added, MediaInput{ID: media.ID})
+		}
+	}
+
+	if len(input.ImageUrls) > 0 {
+		if len(input.Media)+len(added)+len(input.ImageUrls) > maxPostMedia {
+			return input, nil, errTooManyMedia
+		}
+		fromURLs, err := mediaFromURLs(userID, input.ImageUrls)
+		if err != nil {
+			return input, nil, err
+		}
+		added = append(added, fromURLs...)
+	}
+	return input, added, nil
+}
+
+// attachMedia makes inputs, in order, the attachments of postID. The media
+// must belong to userID and be unattached or already on this post; media
+// on the post that is not listed is deleted. It returns the storage keys
+// that deleted media leave unused, to delete once tx commits.
+func attachMedia(tx *gorm.DB, postID, userID uint, inputs []MediaInput) ([]string, error) {
+	if len(inputs) > maxPostMedia {
+		return nil, errTooManyMedia
+	}
+	ids := make([]uint, 0, len(inputs))
+	seen := map[uint]bool{}
+	for _, in := range inputs {
+		if seen[in.ID] {
+			return nil, errInvalidMedia
+		}
+		seen[in.ID] = true
+		ids = append(ids, in.ID)
+		if in.AltText != nil && utf8.RuneCountInString(strings.TrimSpace(*in.AltText)) > maxAltTextLength {
+			return nil, errAltTextTooLong
+		}
+	}
+
+	if len(ids) > 0 {
+		var count int64
+		if err := tx.Model(&models.Media{}).
+			Where("id IN ? AND user_id = ? AND (post_id IS NULL OR post_id = ?)", ids, userID, postID).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count != int64(len(ids)) {
+			return nil, errInvalidMedia
+		}
+	}
+
+	var removed []uint
+	query := tx.Model(&models.Media{}).Where("post_id = ?", postID)
+	if len(ids) > 0 {
+		query = query.Where("id NOT IN ?", ids)
+	}
+	if err := query.Pluck("id", &removed).Error; err != nil {
+		return nil, err
+	}
+	unused, err := models.DeleteMedia(tx, removed)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, in := range inputs {
+		updates := map[string]interface{}{"post_id": postID, "position": i}
+		if in.AltText != nil {
+			updates["alt_text"] = strings.TrimSpace(*in.AltText)
+		}
+		if err := tx.Model(&models.Media{}).Where("id = ?", in.ID).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return unused, nil
+}
+
+// UploadMedia godoc
+// @Summary Upload media
+// @Description Upload an image or video to attach to a post later by passing its ID in the post's media list. Images are stripped of metadata and get resized variants and a blurhash.
+// @Tags posts
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Image or video"
+// @Param alt_text formData string false "Alt text (max 255 characters)"
+// @Success 201 {object} models.Media
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/media [post]
+// @Security ApiKeyAuth
+func UploadMedia(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "File is required"})
+	}
+
+	media, err := uploadMedia(c.UserContext(), userID, file, strings.TrimSpace(c.FormValue("alt_text")))
+	if msg := mediaErrorMessage(err); msg != "" {
+		return c.Status(mediaErrorStatus(err)).JSON(ErrorResponse{Error: msg})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to upload media"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(media)
+}
+
+// ServeMedia godoc
+// @Summary Serve an uploaded file
+// @Description Serve a file from the storage backend. Media URLs point here when files are stored on the local disk.
+// @Tags posts
+// @Produce octet-stream
+// @Param key path string true "Storage key"
+// @Success 200 {file} file
+// @Failure 404 {object} ErrorResponse
+// @Router /media/{key} [get]
+func ServeMedia(c *fiber.Ctx) error {
+	key := c.Params("*")
+	body, err := storage.Current().Get(c.UserContext(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "File not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to read file"})
+	}
+
+	// Only images and videos are shown inline; anything else is offered
+	// as a download so it cannot run as a page on our origin.
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if !services.IsAttachable(contentType) {
+		contentType = fiber.MIMEOctetStream
+		c.Set(fiber.HeaderContentDisposition, "attachment")
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "sandbox")
+	// Keys are random and never reused, so files can be cached for good.
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	return c.SendStream(body)
+}
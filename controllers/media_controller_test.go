@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"socialmedia/internal/testutil"
+	"socialmedia/models"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// countFiles counts the files stored under dir.
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 13)
+	}
+	img.Set(0, 0, color.RGBA{1, 2, 3, 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// createTestMedia uploads data as userID and attaches it to postID.
+func createTestMedia(t *testing.T, userID, postID uint, data []byte) models.Media {
+	t.Helper()
+	media := models.Media{UserID: userID}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := saveMedia(context.Background(), tx, &media, bytes.NewReader(data))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.DB.Model(&media).Update("post_id", postID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return media
+}
+
+func storageUsed(t *testing.T, userID uint) int64 {
+	t.Helper()
+	var user models.User
+	if err := models.DB.Unscoped().First(&user, userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.StorageUsed
+}
+
+func deleteAs(t *testing.T, handler fiber.Handler, route, path string, user models.User) *http.Response {
+	t.Helper()
+	app := fiber.New()
+	app.Delete(route, asUser(user), handler)
+	resp, err := app.Test(httptest.NewRequest(http.MethodDelete, path, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestDeletePostDeletesMedia(t *testing.T) {
+	setupTestDB(t)
+	dir := testutil.UseStorage(t).Dir
+	alice := createTestUser(t, "alice@example.com")
+	bob := createTestUser(t, "bob@example.com")
+	moderator := createTestUser(t, "mod@example.com")
+	data := testPNG(t)
+
+	alicePost := createTestPost(t, alice.ID, "")
+	bobPost := createTestPost(t, bob.ID, "")
+	aliceMedia := createTestMedia(t, alice.ID, alicePost.ID, data)
+	createTestMedia(t, bob.ID, bobPost.ID, data)
+	files := countFiles(t, dir)
+	if files == 0 {
+		t.Fatal("no files stored")
+	}
+
+	resp := deleteAs(t, DeletePost, "/posts/:id", "/posts/"+strconv.Itoa(int(alicePost.ID)), alice)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("DeletePost status = %d", resp.StatusCode)
+	}
+	if got := storageUsed(t, alice.ID); got != 0 {
+		t.Errorf("alice's storage used = %d, want 0", got)
+	}
+	if got := storageUsed(t, bob.ID); got != aliceMedia.Size {
+		t.Errorf("bob's storage used = %d, want %d", got, aliceMedia.Size)
+	}
+	if n := countRows(t, &models.Media{}); n != 1 {
+		t.Errorf("media = %d, want bob's only", n)
+	}
+	// Bob's media still shares the files.
+	if got := countFiles(t, dir); got != files {
+		t.Errorf("files = %d, want %d", got, files)
+	}
+
+	resp = deleteAs(t, AdminDeletePost, "/admin/posts/:id", "/admin/posts/"+strconv.Itoa(int(bobPost.ID)), moderator)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("AdminDeletePost status = %d", resp.StatusCode)
+	}
+	if got := storageUsed(t, bob.ID); got != 0 {
+		t.Errorf("bob's storage used = %d, want 0", got)
+	}
+	if n := countRows(t, &models.Media{}); n != 0 {
+		t.Errorf("media = %d, want none", n)
+	}
+	if n := countRows(t, &models.Blob{}); n != 0 {
+		t.Errorf("blobs = %d, want none", n)
+	}
+	if got := countFiles(t, dir); got != 0 {
+		t.Errorf("files = %d, want none", got)
+	}
+}
+
+func TestSaveMediaConcurrentDuplicate(t *testing.T) {
+	setupTestDB(t)
+	dir := testutil.UseStorage(t).Dir
+	alice := createTestUser(t, "alice@example.com")
+	bob := createTestUser(t, "bob@example.com")
+	data := testPNG(t)
+
+	// Store bob's copy of the file just before alice's blob is created,
+	// after her upload found none to share.
+	var bobMedia models.Media
+	raced := false
+	err := models.DB.Callback().Create().Before("gorm:create").Register("test:race", func(db *gorm.DB) {
+		if raced || db.Statement.Schema == nil || db.Statement.Schema.Table != "blobs" {
+			return
+		}
+		raced = true
+		bobMedia = models.Media{UserID: bob.ID}
+		if _, err := saveMedia(context.Background(), db.Session(&gorm.Session{NewDB: true}), &bobMedia, bytes.NewReader(data)); err != nil {
+			t.Errorf("saving bob's upload: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliceMedia := models.Media{UserID: alice.ID}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := saveMedia(context.Background(), tx, &aliceMedia, bytes.NewReader(data))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("saveMedia() error = %v", err)
+	}
+	if !raced {
+		t.Fatal("no concurrent upload")
+	}
+
+	if aliceMedia.StorageKey != bobMedia.StorageKey || *aliceMedia.BlobID != *bobMedia.BlobID {
+		t.Errorf("alice's media = %s (blob %d), want bob's %s (blob %d)",
+			aliceMedia.StorageKey, *aliceMedia.BlobID, bobMedia.StorageKey, *bobMedia.BlobID)
+	}
+	var blob models.Blob
+	if err := models.DB.First(&blob, *bobMedia.BlobID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if blob.RefCount != 2 {
+		t.Errorf("ref count = %d, want 2", blob.RefCount)
+	}
+	if got := storageUsed(t, alice.ID); got != blob.Size {
+		t.Errorf("alice's storage used = %d, want %d", got, blob.Size)
+	}
+	// Only bob's copy is left.
+	if got, want := countFiles(t, dir), 1+len(bobMedia.Variants); got != want {
+		t.Errorf("files = %d, want %d", got, want)
+	}
+}
+
+func TestCreateAIChatPostRollbackDeletesMedia(t *testing.T) {
+	setupTestDB(t)
+	dir := testutil.UseStorage(t).Dir
+	user := createTestUser(t, "alice@example.com")
+
+	// The first file is stored before the second is rejected.
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("content", "hello")
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"a.png", testPNG(t)}, {"b.txt", []byte("not an image")}} {
+		part, err := w.CreateFormFile("files", f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(f.data)
+	}
+	w.Close()
+
+	app := fiber.New()
+	app.Post("/api/ai-posts", asUser(user), CreateAIChatPost)
+	req := httptest.NewRequest(http.MethodPost, "/api/ai-posts", &body)
+	req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("CreateAIChatPost status = %d, want 400", resp.StatusCode)
+	}
+	if n := countRows(t, &models.Post{}); n != 0 {
+		t.Errorf("posts = %d, want none", n)
+	}
+	if got := countFiles(t, dir); got != 0 {
+		t.Errorf("files = %d, want none", got)
+	}
+}
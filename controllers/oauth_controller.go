@@ -0,0 +1,388 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"socialmedia/models"
+	"socialmedia/services/oidc"
+	"socialmedia/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+)
+
+// oauthState is kept in a signed cookie between the redirect to the provider
+// and the callback. It carries the CSRF state, the PKCE verifier, the ID
+// token nonce and, when a logged-in user is linking an account, that user's
+// ID.
+type oauthState struct {
+	State        string `json:"state"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	Provider     string `json:"provider"`
+	LinkUserID   uint   `json:"link_user_id,omitempty"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+type OAuthURLResponse struct {
+	URL string `json:"url"`
+}
+
+// beginOAuth stores a fresh state cookie and returns the state, nonce and
+// PKCE verifier the provider's authorization URL must be built with.
+func beginOAuth(c *fiber.Ctx, provider string, linkUserID uint) (*oauthState, error) {
+	state, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &oauthState{
+		State:        state,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		Provider:     provider,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oauthStateTTL).Unix(),
+	}
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    utils.SignValue(payload),
+		Path:     "/api/auth",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return st, nil
+}
+
+// consumeOAuthState verifies the state cookie against the callback's state
+// parameter and clears it so it cannot be replayed.
+func consumeOAuthState(c *fiber.Ctx, provider string) (*oauthState, error) {
+	raw := c.Cookies(oauthStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		Path:     "/api/auth",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	if raw == "" {
+		return nil, errors.New("missing OAuth state cookie")
+	}
+
+	payload, err := utils.VerifySignedValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	var st oauthState
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, err
+	}
+	if st.Provider != provider || time.Now().Unix() > st.ExpiresAt {
+		return nil, errors.New("OAuth state expired")
+	}
+	if query := c.Query("state"); query == "" || query != st.State {
+		return nil, errors.New("OAuth state mismatch")
+	}
+	return &st, nil
+}
+
+// externalProfile is the subset of an identity provider's user info we use.
+type externalProfile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// finishOAuth logs in, registers or links an account once the provider has
+// authenticated the user.
+func finishOAuth(c *fiber.Ctx, st *oauthState, profile externalProfile) error {
+	var identity models.OAuthIdentity
+	err := models.DB.Where("provider = ? AND subject = ?", profile.Provider, profile.Subject).First(&identity).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to look up identity"})
+	}
+
+	// Linking an external account to the logged-in user.
+	if st.LinkUserID != 0 {
+		if found {
+			if identity.UserID == st.LinkUserID {
+				return c.JSON(MessageResponse{Message: "Account already linked"})
+			}
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "This account is already linked to another user"})
+		}
+		identity = models.OAuthIdentity{
+			UserID:   st.LinkUserID,
+			Provider: profile.Provider,
+			Subject:  profile.Subject,
+			Email:    profile.Email,
+		}
+		if err := models.DB.Create(&identity).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to link account"})
+		}
+		return c.JSON(identity)
+	}
+
+	// Returning user.
+	if found {
+		var user models.User
+		if err := models.DB.First(&user, identity.UserID).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "User not found"})
+		}
+		return beginLogin(c, user)
+	}
+
+	// Never merge into an existing account by email: whoever controls the
+	// external account may not own the local one. The owner can log in and
+	// link it explicitly instead.
+	var existing models.User
+	if err := models.DB.Where("email = ?", profile.Email).First(&existing).Error; err == nil {
+		// Accounts created by the old Google flow have no password and no
+		// identity row yet; adopt them when Google vouches for the email.
+		if profile.Provider == "google" && profile.EmailVerified && existing.Password == "" && !hasIdentities(existing.ID) {
+			if err := models.DB.Create(&models.OAuthIdentity{
+				UserID:   existing.ID,
+				Provider: profile.Provider,
+				Subject:  profile.Subject,
+				Email:    profile.Email,
+			}).Error; err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to link account"})
+			}
+			return beginLogin(c, existing)
+		}
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
+			Error: "An account with this email already exists. Log in and link your " + profile.Provider + " account from your settings.",
+		})
+	}
+
+	user := models.User{
+		Email:          profile.Email,
+		Name:           profile.Name,
+		Username:       utils.GenerateUsername(profile.Name),
+		ProfilePicture: profile.Picture,
+	}
+	if profile.EmailVerified {
+		verifiedAt := time.Now()
+		user.EmailVerifiedAt = &verifiedAt
+	}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OAuthIdentity{
+			UserID:   user.ID,
+			Provider: profile.Provider,
+			Subject:  profile.Subject,
+			Email:    profile.Email,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to create user"})
+	}
+
+	return completeLogin(c, user)
+}
+
+func hasIdentities(userID uint) bool {
+	var count int64
+	models.DB.Model(&models.OAuthIdentity{}).Where("user_id = ?", userID).Count(&count)
+	return count > 0
+}
+
+// OAuthLogin godoc
+// @Summary Log in with an identity provider
+// @Description Redirect the client to the consent page of a configured OpenID Connect provider, e.g. "google"
+// @Tags Auth
+// @Param provider path string true "Provider name"
+// @Success 307
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/auth/{provider} [get]
+func OAuthLogin(registry *oidc.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		provider, err := registry.Get(c.Params("provider"))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Unknown identity provider"})
+		}
+		url, err := authorizationURL(c, provider, 0)
+		if err != nil {
+			log.Printf("Could not start OAuth flow with %s: %v", provider.Name, err)
+			return c.Status(fiber.StatusBadGateway).JSON(ErrorResponse{Error: "Could not start OAuth flow"})
+		}
+		return c.Redirect(url, fiber.StatusTemporaryRedirect)
+	}
+}
+
+// LinkOAuth godoc
+// @Summary Link an identity provider account
+// @Description Start linking an external account to the authenticated user. Navigate the browser to the returned URL; the callback attaches the identity to this user.
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} OAuthURLResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/auth/{provider}/link [post]
+// @Security ApiKeyAuth
+func LinkOAuth(registry *oidc.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		provider, err := registry.Get(c.Params("provider"))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Unknown identity provider"})
+		}
+		url, err := authorizationURL(c, provider, c.Locals("user_id").(uint))
+		if err != nil {
+			log.Printf("Could not start OAuth flow with %s: %v", provider.Name, err)
+			return c.Status(fiber.StatusBadGateway).JSON(ErrorResponse{Error: "Could not start OAuth flow"})
+		}
+		return c.JSON(OAuthURLResponse{URL: url})
+	}
+}
+
+// authorizationURL starts an OAuth flow with the provider and returns the URL
+// to send the browser to.
+func authorizationURL(c *fiber.Ctx, provider *oidc.Provider, linkUserID uint) (string, error) {
+	st, err := beginOAuth(c, provider.Name, linkUserID)
+	if err != nil {
+		return "", err
+	}
+	return provider.AuthCodeURL(c.UserContext(), st.State, st.Nonce, utils.PKCEChallenge(st.CodeVerifier))
+}
+
+// OAuthCallback godoc
+// @Summary Identity provider callback
+// @Description Complete an OpenID Connect login or account link. Logs in returning users, registers new ones and returns a 2fa_required challenge when two-factor authentication is enabled.
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param state query string true "OAuth state"
+// @Param code query string true "Authorization code"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/auth/{provider}/callback [get]
+func OAuthCallback(registry *oidc.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		provider, err := registry.Get(c.Params("provider"))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Unknown identity provider"})
+		}
+
+		st, err := consumeOAuthState(c, provider.Name)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid OAuth state"})
+		}
+
+		if errCode := c.Query("error"); errCode != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Identity provider returned " + errCode})
+		}
+		code := c.Query("code")
+		if code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Code not found"})
+		}
+
+		// Exchange the code and verify the ID token it comes with.
+		claims, err := provider.Authenticate(c.UserContext(), code, st.CodeVerifier, st.Nonce)
+		if err != nil {
+			log.Printf("OIDC login with %s failed: %v", provider.Name, err)
+			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Could not authenticate with identity provider"})
+		}
+
+		return finishOAuth(c, st, externalProfile{
+			Provider:      provider.Name,
+			Subject:       claims.Subject,
+			Email:         claims.Email,
+			EmailVerified: claims.EmailVerified,
+			Name:          claims.Name,
+			Picture:       claims.Picture,
+		})
+	}
+}
+
+// ListIdentities godoc
+// @Summary List linked accounts
+// @Description List the external identity provider accounts linked to the authenticated user
+// @Tags Auth
+// @Produce json
+// @Success 200 {array} models.OAuthIdentity
+// @Failure 500 {object} ErrorResponse
+// @Router /api/identities [get]
+// @Security ApiKeyAuth
+func ListIdentities(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var identities []models.OAuthIdentity
+	if err := models.DB.Where("user_id = ?", userID).Order("created_at asc").Find(&identities).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch linked accounts"})
+	}
+	return c.JSON(identities)
+}
+
+// UnlinkIdentity godoc
+// @Summary Unlink an account
+// @Description Remove a linked identity provider account. The last login method of an account without a password cannot be removed.
+// @Tags Auth
+// @Produce json
+// @Param id path int true "Identity ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/identities/{id} [delete]
+// @Security ApiKeyAuth
+func UnlinkIdentity(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	identityID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid identity ID"})
+	}
+
+	var identity models.OAuthIdentity
+	if err := models.DB.Where("id = ? AND user_id = ?", identityID, user.ID).First(&identity).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Linked account not found"})
+	}
+
+	if user.Password == "" {
+		var count int64
+		if err := models.DB.Model(&models.OAuthIdentity{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to unlink account"})
+		}
+		if count <= 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Set a password with the password reset flow before unlinking your only login method"})
+		}
+	}
+
+	if err := models.DB.Delete(&identity).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to unlink account"})
+	}
+	return c.JSON(MessageResponse{Message: "Account unlinked"})
+}
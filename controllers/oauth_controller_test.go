@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"socialmedia/config"
+	"socialmedia/models"
+	"socialmedia/services/oidc"
+	"socialmedia/services/oidc/oidctest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// oauthTest drives the OAuth endpoints against fake "test" and "google"
+// issuers.
+type oauthTest struct {
+	app      *fiber.App
+	issuers  map[string]*oidctest.Issuer
+	linkUser models.User
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	t.Helper()
+	setupTestDB(t)
+
+	o := &oauthTest{app: fiber.New(), issuers: make(map[string]*oidctest.Issuer)}
+	var providers []config.OIDCProvider
+	for _, name := range []string{"test", "google"} {
+		issuer := oidctest.NewIssuer(t, name+"-client")
+		o.issuers[name] = issuer
+		providers = append(providers, config.OIDCProvider{
+			Name:        name,
+			Issuer:      issuer.URL,
+			ClientID:    issuer.ClientID,
+			RedirectURL: "http://localhost/api/auth/" + name + "/callback",
+			Scopes:      []string{"openid", "email", "profile"},
+		})
+	}
+	registry := oidc.NewRegistry(providers)
+
+	o.app.Get("/api/auth/:provider", OAuthLogin(registry))
+	o.app.Get("/api/auth/:provider/callback", OAuthCallback(registry))
+	o.app.Post("/api/auth/:provider/link", func(c *fiber.Ctx) error {
+		return asUser(o.linkUser)(c)
+	}, LinkOAuth(registry))
+	return o
+}
+
+// oauthFlow is a started OAuth flow: the state cookie and the parameters the
+// provider was sent.
+type oauthFlow struct {
+	provider string
+	cookie   *http.Cookie
+	state    string
+	nonce    string
+}
+
+// login starts a login flow with provider.
+func (o *oauthTest) login(t *testing.T, provider string) oauthFlow {
+	t.Helper()
+	resp, err := o.app.Test(httptest.NewRequest(http.MethodGet, "/api/auth/"+provider, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusTemporaryRedirect {
+		t.Fatalf("login status = %d, want %d", resp.StatusCode, fiber.StatusTemporaryRedirect)
+	}
+	return o.flow(t, provider, resp, resp.Header.Get(fiber.HeaderLocation))
+}
+
+// link starts linking provider to user.
+func (o *oauthTest) link(t *testing.T, provider string, user models.User) oauthFlow {
+	t.Helper()
+	o.linkUser = user
+	resp, err := o.app.Test(httptest.NewRequest(http.MethodPost, "/api/auth/"+provider+"/link", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body OAuthURLResponse
+	decodeJSON(t, resp, &body)
+	return o.flow(t, provider, resp, body.URL)
+}
+
+func (o *oauthTest) flow(t *testing.T, provider string, resp *http.Response, authURL string) oauthFlow {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := oauthFlow{provider: provider, state: u.Query().Get("state"), nonce: u.Query().Get("nonce")}
+	for _, c := range resp.Cookies() {
+		if c.Name == oauthStateCookie {
+			f.cookie = c
+		}
+	}
+	if f.cookie == nil || f.state == "" || f.nonce == "" {
+		t.Fatalf("flow not started: url %s, cookies %v", authURL, resp.Cookies())
+	}
+	return f
+}
+
+// callback returns to the callback with state and an authorization code
+// for an ID token with claims.
+func (o *oauthTest) callback(t *testing.T, f oauthFlow, state string, claims jwt.MapClaims) *http.Response {
+	t.Helper()
+	code := o.issuers[f.provider].Code(claims)
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/"+f.provider+"/callback?"+url.Values{
+		"state": {state},
+		"code":  {code},
+	}.Encode(), nil)
+	req.AddCookie(&http.Cookie{Name: f.cookie.Name, Value: f.cookie.Value})
+	resp, err := o.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// claims returns valid ID token claims for the flow.
+func (o *oauthTest) claims(f oauthFlow, subject, email string) jwt.MapClaims {
+	return o.issuers[f.provider].Claims(subject, email, f.nonce)
+}
+
+func countRows(t *testing.T, model interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := models.DB.Model(model).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestOAuthCallbackRejectsStateMismatch(t *testing.T) {
+	o := newOAuthTest(t)
+	f := o.login(t, "test")
+
+	resp := o.callback(t, f, "not-the-state", o.claims(f, "sub-1", "new@example.com"))
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+
+	// A state cookie from one provider cannot complete another's flow.
+	other := f
+	other.provider = "google"
+	resp = o.callback(t, other, f.state, o.claims(other, "sub-1", "new@example.com"))
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("cross-provider status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+
+	// A tampered cookie is rejected.
+	f.cookie.Value += "x"
+	resp = o.callback(t, f, f.state, o.claims(f, "sub-1", "new@example.com"))
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("tampered cookie status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+
+	if n := countRows(t, &models.User{}); n != 0 {
+		t.Errorf("users = %d, want 0", n)
+	}
+}
+
+func TestOAuthCallbackRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		adjust func(jwt.MapClaims)
+	}{
+		{"nonce mismatch", func(c jwt.MapClaims) { c["nonce"] = "another-nonce" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOAuthTest(t)
+			f := o.login(t, "test")
+			claims := o.claims(f, "sub-1", "new@example.com")
+			tt.adjust(claims)
+
+			resp := o.callback(t, f, f.state, claims)
+			if resp.StatusCode != fiber.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+			}
+			if n := countRows(t, &models.User{}); n != 0 {
+				t.Errorf("users = %d, want 0", n)
+			}
+		})
+	}
+}
+
+func TestOAuthCallbackCreatesAccount(t *testing.T) {
+	o := newOAuthTest(t)
+
+	f := o.login(t, "test")
+	resp := o.callback(t, f, f.state, o.claims(f, "sub-1", "new@example.com"))
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	var body AuthResponse
+	decodeJSON(t, resp, &body)
+	if body.Status != "success" || body.Token == "" || body.User == nil {
+		t.Fatalf("response = %+v", body)
+	}
+	if body.User.Email != "new@example.com" || !body.User.EmailVerified {
+		t.Errorf("user = %+v", body.User)
+	}
+
+	var identity models.OAuthIdentity
+	if err := models.DB.Where("provider = ? AND subject = ?", "test", "sub-1").First(&identity).Error; err != nil {
+		t.Fatalf("identity not created: %v", err)
+	}
+	if identity.UserID != body.User.ID {
+		t.Errorf("identity user = %d, want %d", identity.UserID, body.User.ID)
+	}
+
+	// Logging in again finds the same account.
+	f = o.login(t, "test")
+	resp = o.callback(t, f, f.state, o.claims(f, "sub-1", "new@example.com"))
+	var again AuthResponse
+	decodeJSON(t, resp, &again)
+	if again.Status != "success" || again.User == nil || again.User.ID != body.User.ID {
+		t.Errorf("second login = %+v", again)
+	}
+	if n := countRows(t, &models.User{}); n != 1 {
+		t.Errorf("users = %d, want 1", n)
+	}
+}
+
+func TestOAuthCallbackExistingEmail(t *testing.T) {
+	o := newOAuthTest(t)
+	createTestUser(t, "taken@example.com", func(u *models.User) { u.Password = "hash" })
+	legacy := createTestUser(t, "legacy@example.com")
+
+	// A provider never takes over an existing account by email.
+	f := o.login(t, "test")
+	resp := o.callback(t, f, f.state, o.claims(f, "sub-1", "taken@example.com"))
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusConflict)
+	}
+	f = o.login(t, "test")
+	resp = o.callback(t, f, f.state, o.claims(f, "sub-2", "legacy@example.com"))
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("legacy account via test status = %d, want %d", resp.StatusCode, fiber.StatusConflict)
+	}
+
+	// Google must vouch for the email to adopt a legacy account.
+	f = o.login(t, "google")
+	claims := o.claims(f, "google-1", "legacy@example.com")
+	claims["email_verified"] = false
+	resp = o.callback(t, f, f.state, claims)
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("unverified email status = %d, want %d", resp.StatusCode, fiber.StatusConflict)
+	}
+	if n := countRows(t, &models.OAuthIdentity{}); n != 0 {
+		t.Fatalf("identities = %d, want 0", n)
+	}
+
+	f = o.login(t, "google")
+	resp = o.callback(t, f, f.state, o.claims(f, "google-1", "legacy@example.com"))
+	var body AuthResponse
+	decodeJSON(t, resp, &body)
+	if body.Status != "success" || body.User == nil || body.User.ID != legacy.ID {
+		t.Fatalf("adopting legacy account = %+v", body)
+	}
+	var identity models.OAuthIdentity
+	if err := models.DB.Where("provider = ? AND subject = ?", "google", "google-1").First(&identity).Error; err != nil || identity.UserID != legacy.ID {
+		t.Errorf("identity = %+v, err %v", identity, err)
+	}
+
+	// Once it has an identity the account is no longer adopted by email.
+	f = o.login(t, "google")
+	resp = o.callback(t, f, f.state, o.claims(f, "google-2", "legacy@example.com"))
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("second google account status = %d, want %d", resp.StatusCode, fiber.StatusConflict)
+	}
+}
+
+func TestOAuthLinkExistingAccount(t *testing.T) {
+	o := newOAuthTest(t)
+	now := time.Now()
+	user := createTestUser(t, "owner@example.com", func(u *models.User) {
+		u.Password = "hash"
+		u.EmailVerifiedAt = &now
+	})
+	other := createTestUser(t, "other@example.com", func(u *models.User) { u.Password = "hash" })
+
+	// The owner links an external account with the same verified email.
+	f := o.link(t, "test", user)
+	resp := o.callback(t, f, f.state, o.claims(f, "sub-1", "owner@example.com"))
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("link status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	var identity models.OAuthIdentity
+	decodeJSON(t, resp, &identity)
+	if identity.UserID != user.ID || identity.Provider != "test" {
+		t.Fatalf("linked identity = %+v", identity)
+	}
+
+	// Logging in with it now reaches the owner's account.
+	f = o.login(t, "test")
+	resp = o.callback(t, f, f.state, o.claims(f, "sub-1", "owner@example.com"))
+	var body AuthResponse
+	decodeJSON(t, resp, &body)
+	if body.Status != "success" || body.User == nil || body.User.ID != user.ID {
+		t.Errorf("login with linked identity = %+v", body)
+	}
+
+	// The same external account cannot be linked to someone else.
+	f = o.link(t, "test", other)
+	resp = o.callback(t, f, f.state, o.claims(f, "sub-1", "owner@example.com"))
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("relink status = %d, want %d", resp.StatusCode, fiber.StatusConflict)
+	}
+	if n := countRows(t, &models.OAuthIdentity{}); n != 1 {
+		t.Errorf("identities = %d, want 1", n)
+	}
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"socialmedia/config"
+	"socialmedia/mailer"
+	"socialmedia/models"
+	"socialmedia/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const minPasswordLength = 8
+
+var errTokenUsed = errors.New("token already used")
+
+type ForgotPasswordInput struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use password reset link. The response is the same whether or not the email is registered.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param forgotPasswordInput body ForgotPasswordInput true "Account email"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} AuthResponse
+// @Failure 500 {object} AuthResponse
+// @Router /api/password/forgot [post]
+func ForgotPassword(c *fiber.Ctx) error {
+	var input ForgotPasswordInput
+	if err := c.BodyParser(&input); err != nil || input.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Email is required",
+		})
+	}
+
+	// Don't reveal whether the account exists.
+	response := AuthResponse{
+		Status:  "success",
+		Message: "If an account exists for that email, a reset link has been sent",
+	}
+
+	var user models.User
+	if err := models.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		return c.JSON(response)
+	}
+
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not create reset token",
+		})
+	}
+
+	now := time.Now()
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the most recently requested link stays valid.
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(config.PasswordResetTTL),
+		}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not create reset token",
+		})
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.AppURL, token)
+	mailer.SendAsync(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.",
+			user.Name, config.PasswordResetTTL, link),
+	})
+
+	return c.JSON(response)
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Set a new password using a reset token. All existing sessions of the user are revoked and their personal access tokens deleted.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param resetPasswordInput body ResetPasswordInput true "Reset token and new password"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} AuthResponse
+// @Failure 500 {object} AuthResponse
+// @Router /api/password/reset [post]
+func ResetPassword(c *fiber.Ctx) error {
+	var input ResetPasswordInput
+	if err := c.BodyParser(&input); err != nil || input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Reset token is required",
+		})
+	}
+	if len(input.Password) < minPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: fmt.Sprintf("Password must be at least %d characters", minPasswordLength),
+		})
+	}
+
+	invalid := func() error {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Invalid or expired reset token",
+		})
+	}
+
+	var reset models.PasswordReset
+	if err := models.DB.Where("token_hash = ?", utils.HashToken(input.Token)).First(&reset).Error; err != nil {
+		return invalid()
+	}
+	now := time.Now()
+	if reset.UsedAt != nil || now.After(reset.ExpiresAt) {
+		return invalid()
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), 14)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not hash password",
+		})
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		// Claim the token first so concurrent requests cannot both use it.
+		result := tx.Model(&models.PasswordReset{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTokenUsed
+		}
+
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", reset.UserID).
+			Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+
+		// Whoever knew the old password may have made tokens with it.
+		if err := tx.Where("user_id = ?", reset.UserID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		return revokeAllSessions(tx, reset.UserID)
+	})
+	if err == errTokenUsed {
+		return invalid()
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not reset password",
+		})
+	}
+
+	return c.JSON(AuthResponse{
+		Status:  "success",
+		Message: "Password has been reset. Please log in again.",
+	})
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+	"socialmedia/models"
+	"socialmedia/utils"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestResetPasswordRevokesCredentials(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice@example.com")
+	_, token := createTestToken(t, user, "posts:write", time.Now().Add(time.Hour))
+	session := models.Session{UserID: user.ID, RefreshTokenHash: "hash", LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := models.DB.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	reset := models.PasswordReset{UserID: user.ID, TokenHash: utils.HashToken("reset"), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := models.DB.Create(&reset).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Post("/api/password/reset", ResetPassword)
+	resp, _ := postJSON(t, app, "/api/password/reset", ResetPasswordInput{Token: "reset", Password: "a new password"})
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("ResetPassword status = %d", resp.StatusCode)
+	}
+
+	if err := models.DB.First(&session, session.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if session.RevokedAt == nil {
+		t.Error("session still active")
+	}
+	if n := countRows(t, &models.PersonalAccessToken{}); n != 0 {
+		t.Errorf("personal access tokens = %d, want none", n)
+	}
+	if got := requestWithToken(t, newScopedApp(), http.MethodGet, "/api/posts", token); got != fiber.StatusUnauthorized {
+		t.Errorf("token status after the reset = %d, want 401", got)
+	}
+}
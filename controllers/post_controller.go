@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"context"
 	"socialmedia/models"
+	"socialmedia/services/storage"
 	"strconv"
 	"time"
 
@@ -12,6 +14,9 @@ import (
 type PostInput struct {
 	Content   string   `json:"content"`
 	ImageUrls []string `json:"image_urls,omitempty"`
+	// Media lists the post's attachments in order. On edit it replaces the
+	// current attachments; leave it out to keep them.
+	Media []MediaInput `json:"media,omitempty"`
 }
 
 type MessageResponse struct {
@@ -26,9 +31,9 @@ type PostListResponse struct {
 
 // CreatePost allows an authenticated user to create a new post.
 // @Summary Create a new post
-// @Description Create a new post with content and optional image URL
+// @Description Create a new post with content and up to 10 attachments: media uploaded earlier (media), image URLs (image_urls) or, with a multipart form, files uploaded along with the post (files, each with an alt_text). Listed media come first, then files, then image URLs.
 // @Tags posts
-// @Accept json
+// @Accept json,mpfd
 // @Produce json
 // @Param postInput body PostInput true "Post Input"
 // @Success 200 {object} models.Post
@@ -38,26 +43,35 @@ type PostListResponse struct {
 func CreatePost(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
-	var input PostInput
-	if err := c.BodyParser(&input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	input, added, err := parsePostInput(c, userID)
+	if err != nil {
+		return postInputError(c, err)
 	}
 
 	post := models.Post{
-		Content: input.Content,
-		// Media:  input.ImageUrls,
+		Content:    input.Content,
 		UserID:     userID,
 		LikeCount:  0,
 		ShareCount: 0,
 		ViewCount:  0,
 	}
 
-	if err := models.DB.Create(&post).Error; err != nil {
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		_, err := attachMedia(tx, post.ID, userID, append(input.Media, added...))
+		return err
+	})
+	if msg := mediaErrorMessage(err); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	// Reload the post with relationships
-	if err := models.DB.Preload("User").Preload("Likes").Preload("Comments").First(&post, post.ID).Error; err != nil {
+	if err := models.DB.Preload("User").Scopes(models.PreloadMedia, models.PreloadInteractions(userID)).First(&post, post.ID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load post relationships"})
 	}
 
@@ -66,9 +80,9 @@ func CreatePost(c *fiber.Ctx) error {
 
 // EditPost allows the owner to update a post.
 // @Summary Edit a post
-// @Description Edit a post's content and image URL
+// @Description Edit a post's content and attachments. The media list, if given, becomes the post's attachments in order: leave an item out to remove it, or change the order to reorder. New files and image URLs are added after them.
 // @Tags posts
-// @Accept json
+// @Accept json,mpfd
 // @Produce json
 // @Param id path int true "Post ID"
 // @Param postInput body PostInput true "Post Input"
@@ -93,21 +107,49 @@ func EditPost(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not authorized"})
 	}
 
-	var input PostInput
-	if err := c.BodyParser(&input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	input, added, err := parsePostInput(c, userID)
+	if err != nil {
+		return postInputError(c, err)
+	}
+
+	// Keep the current attachments unless the request lists them.
+	attachments := input.Media
+	if attachments == nil && len(added) > 0 {
+		var ids []uint
+		if err := models.DB.Model(&models.Media{}).Where("post_id = ?", post.ID).
+			Scopes(models.MediaInOrder).Pluck("id", &ids).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update post"})
+		}
+		for _, id := range ids {
+			attachments = append(attachments, MediaInput{ID: id})
+		}
 	}
 
 	post.Content = input.Content
-	// post.Media= input.ImageUrls
 	post.UpdatedAt = time.Now()
 
-	if err := models.DB.Save(&post).Error; err != nil {
+	var unused []string
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&post).Error; err != nil {
+			return err
+		}
+		if attachments == nil {
+			return nil
+		}
+		var err error
+		unused, err = attachMedia(tx, post.ID, userID, append(attachments, added...))
+		return err
+	})
+	if msg := mediaErrorMessage(err); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update post"})
 	}
+	storage.DeleteAll(c.UserContext(), unused)
 
 	// Reload the post with relationships
-	if err := models.DB.Preload("User").Preload("Likes").Preload("Comments").First(&post, post.ID).Error; err != nil {
+	if err := models.DB.Preload("User").Scopes(models.PreloadMedia, models.PreloadInteractions(userID)).First(&post, post.ID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load post relationships"})
 	}
 
@@ -132,6 +174,7 @@ func EditPost(c *fiber.Ctx) error {
 // @Failure 400 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /posts/{id} [delete]
 func DeletePost(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
@@ -149,10 +192,35 @@ func DeletePost(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not authorized"})
 	}
 
-	models.DB.Delete(&post)
+	if err := deletePost(c.UserContext(), &post); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete post"})
+	}
 	return c.JSON(fiber.Map{"message": "Post deleted"})
 }
 
+// deletePost deletes post along with its media, giving back the storage the
+// media was charged to, and deletes the stored files nothing else uses once
+// that has been committed.
+func deletePost(ctx context.Context, post *models.Post) error {
+	var unused []string
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var mediaIDs []uint
+		if err := tx.Model(&models.Media{}).Where("post_id = ?", post.ID).Pluck("id", &mediaIDs).Error; err != nil {
+			return err
+		}
+		var err error
+		if unused, err = models.DeleteMedia(tx, mediaIDs); err != nil {
+			return err
+		}
+		return tx.Delete(post).Error
+	})
+	if err != nil {
+		return err
+	}
+	storage.DeleteAll(ctx, unused)
+	return nil
+}
+
 // Timeline returns posts created by the authenticated user and those they follow.
 // @Summary Get timeline posts
 // @Description Get posts created by the authenticated user and those they follow
@@ -175,7 +243,12 @@ func Timeline(c *fiber.Ctx) error {
 	}
 
 	var posts []models.Post
-	models.DB.Preload("User").Where("user_id IN ?", ids).Order("created_at desc").Find(&posts)
+	models.DB.Preload("User").
+		Scopes(models.PreloadMedia).
+		Where("user_id IN ?", ids).
+		Scopes(models.HideBlockedAndMuted(userID, "user_id")).
+		Order("created_at desc").
+		Find(&posts)
 
 	return c.JSON(posts)
 }
@@ -208,7 +281,13 @@ func PostList(c *fiber.Ctx) error {
 	var posts []models.Post
 	var total int64
 
-	if err := models.DB.Model(&models.Post{}).Count(&total).Error; err != nil {
+	// Leave out posts by users the caller has blocked, been blocked by or
+	// muted, and by private users the caller does not follow.
+	visible := func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(models.HideBlockedAndMuted(userID, "user_id"), models.HidePrivate(userID, "user_id"))
+	}
+
+	if err := models.DB.Model(&models.Post{}).Scopes(visible).Count(&total).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to count posts",
 		})
@@ -216,9 +295,9 @@ func PostList(c *fiber.Ctx) error {
 
 	// Get posts with all relationships
 	if err := models.DB.
+		Scopes(visible).
 		Preload("User").
-		Preload("Likes").
-		Preload("Comments").
+		Scopes(models.PreloadMedia, models.PreloadInteractions(userID)).
 		Order("created_at desc").
 		Limit(limit).
 		Offset(offset).
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"socialmedia/models"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func createTestPost(t *testing.T, userID uint, postType string) models.Post {
+	t.Helper()
+	post := models.Post{UserID: userID, Content: "hello", PostType: postType}
+	if err := models.DB.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func getAs(t *testing.T, handler fiber.Handler, route, path string, user models.User) *http.Response {
+	t.Helper()
+	app := fiber.New()
+	app.Get(route, asUser(user), handler)
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestPostListHidesInteractionsFromHiddenUsers(t *testing.T) {
+	setupTestDB(t)
+	viewer := createTestUser(t, "viewer@example.com")
+	author := createTestUser(t, "author@example.com")
+	friend := createTestUser(t, "friend@example.com")
+	blocked := createTestUser(t, "blocked@example.com")
+	blocker := createTestUser(t, "blocker@example.com")
+	muted := createTestUser(t, "muted@example.com")
+	private := createTestUser(t, "private@example.com", func(u *models.User) { u.IsPrivate = true })
+	followed := createTestUser(t, "followed@example.com", func(u *models.User) { u.IsPrivate = true })
+	models.DB.Create(&models.Follow{FollowerID: viewer.ID, FollowingID: followed.ID})
+	models.DB.Create(&models.Block{BlockerID: viewer.ID, BlockedID: blocked.ID})
+	models.DB.Create(&models.Block{BlockerID: blocker.ID, BlockedID: viewer.ID})
+	models.DB.Create(&models.Mute{MuterID: viewer.ID, MutedID: muted.ID})
+
+	post := createTestPost(t, author.ID, "regular")
+	for _, u := range []models.User{viewer, friend, blocked, blocker, muted} {
+		models.DB.Create(&models.Comment{PostID: post.ID, UserID: u.ID, Content: "comment"})
+		models.DB.Create(&models.Like{PostID: &post.ID, UserID: u.ID})
+	}
+	models.DB.Create(&models.Comment{PostID: post.ID, UserID: private.ID, Content: "comment"})
+	models.DB.Create(&models.Comment{PostID: post.ID, UserID: followed.ID, Content: "comment"})
+
+	resp := getAs(t, PostList, "/api/posts", "/api/posts", viewer)
+	var body PostListResponse
+	decodeJSON(t, resp, &body)
+	if len(body.Posts) != 1 {
+		t.Fatalf("posts = %d, want 1", len(body.Posts))
+	}
+
+	got := body.Posts[0]
+	want := map[uint]bool{viewer.ID: true, friend.ID: true, followed.ID: true}
+	if len(got.Comments) != len(want) {
+		t.Errorf("comments = %d, want %d", len(got.Comments), len(want))
+	}
+	for _, comment := range got.Comments {
+		if !want[comment.UserID] {
+			t.Errorf("comment by hidden user %d embedded", comment.UserID)
+		}
+	}
+	delete(want, followed.ID)
+	if len(got.Likes) != len(want) {
+		t.Errorf("likes = %d, want %d", len(got.Likes), len(want))
+	}
+	for _, like := range got.Likes {
+		if !want[like.UserID] {
+			t.Errorf("like by hidden user %d embedded", like.UserID)
+		}
+	}
+	if !got.ILiked {
+		t.Error("i_liked = false for the viewer's own like")
+	}
+}
+
+func TestPostListHidesAuthorAccountState(t *testing.T) {
+	setupTestDB(t)
+	viewer := createTestUser(t, "viewer@example.com")
+	now := time.Now()
+	author := createTestUser(t, "author@example.com", func(u *models.User) {
+		u.EmailVerifiedAt = &now
+		u.TwoFactorEnabled = true
+		u.Role = models.RoleModerator
+		u.SuspensionReason = "note for moderators"
+		u.DeletionScheduledAt = &now
+	})
+	createTestPost(t, author.ID, "regular")
+
+	resp := getAs(t, PostList, "/api/posts", "/api/posts", viewer)
+	var body struct {
+		Posts []struct {
+			User map[string]interface{} `json:"user"`
+		} `json:"posts"`
+	}
+	decodeJSON(t, resp, &body)
+	if len(body.Posts) != 1 {
+		t.Fatalf("posts = %d, want 1", len(body.Posts))
+	}
+	for _, field := range []string{"email_verified_at", "two_factor_enabled", "role", "suspended_at", "suspension_reason", "deletion_scheduled_at"} {
+		if _, ok := body.Posts[0].User[field]; ok {
+			t.Errorf("author has %s", field)
+		}
+	}
+}
+
+func TestGetAIChatPostBlocked(t *testing.T) {
+	setupTestDB(t)
+	viewer := createTestUser(t, "viewer@example.com")
+	author := createTestUser(t, "author@example.com")
+	post := createTestPost(t, author.ID, "ai")
+	path := "/api/ai-posts/" + strconv.FormatUint(uint64(post.ID), 10)
+
+	if resp := getAs(t, GetAIChatPost, "/api/ai-posts/:id", path, viewer); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	models.DB.Create(&models.Block{BlockerID: author.ID, BlockedID: viewer.ID})
+	if resp := getAs(t, GetAIChatPost, "/api/ai-posts/:id", path, viewer); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("blocked status = %d, want %d", resp.StatusCode, fiber.StatusForbidden)
+	}
+}
+
+func TestGetAIChatPostPrivate(t *testing.T) {
+	setupTestDB(t)
+	viewer := createTestUser(t, "viewer@example.com")
+	author := createTestUser(t, "author@example.com", func(u *models.User) { u.IsPrivate = true })
+	post := createTestPost(t, author.ID, "ai")
+	path := "/api/ai-posts/" + strconv.FormatUint(uint64(post.ID), 10)
+
+	if resp := getAs(t, GetAIChatPost, "/api/ai-posts/:id", path, viewer); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("non-follower status = %d, want %d", resp.StatusCode, fiber.StatusForbidden)
+	}
+	if resp := getAs(t, GetAIChatPost, "/api/ai-posts/:id", path, author); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("author status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	models.DB.Create(&models.Follow{FollowerID: viewer.ID, FollowingID: author.ID})
+	if resp := getAs(t, GetAIChatPost, "/api/ai-posts/:id", path, viewer); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("follower status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+}
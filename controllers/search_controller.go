@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"socialmedia/models"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UserSearchResponse is a page of user search results. NextCursor is empty
+// on the last page.
+type UserSearchResponse struct {
+	Users      []UserSummaryResponse `json:"users"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// userSearchRow is a user along with the ranks SearchUsers computes.
+type userSearchRow struct {
+	models.User
+	MatchRank    int
+	RelationRank int
+}
+
+// searchCursor is the position of the last result on a page, in the order
+// search results are sorted by.
+type searchCursor struct {
+	matchRank, relationRank int
+	followerCount           int64
+	id                      uint
+}
+
+func (c searchCursor) encode() string {
+	raw := fmt.Sprintf("%d.%d.%d.%d", c.matchRank, c.relationRank, c.followerCount, c.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSearchCursor(s string) (searchCursor, error) {
+	var c searchCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	_, err = fmt.Sscanf(string(raw), "%d.%d.%d.%d", &c.matchRank, &c.relationRank, &c.followerCount, &c.id)
+	return c, err
+}
+
+// SearchUsers godoc
+// @Summary Search users
+// @Description Find users by username or name. Exact usernames come first, then prefix matches, then names containing the query, then fuzzy matches. Within each, people you both follow come first, then people you follow, then people who follow you, then by follower count. Pass next_cursor back as cursor for the next page.
+// @Tags User
+// @Produce json
+// @Param q query string true "Search query"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param limit query int false "Users per page (default: 20, max 100)"
+// @Success 200 {object} UserSearchResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/search [get]
+// @Security ApiKeyAuth
+func SearchUsers(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	term := models.NormalizeSearchTerm(c.Query("q"))
+	if term == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Search query is required"})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := models.SearchUsers(models.DB, userID, term)
+	if s := c.Query("cursor"); s != "" {
+		cursor, err := decodeSearchCursor(s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid cursor"})
+		}
+		query = query.Where("(match_rank, relation_rank, follower_count, id) < (?, ?, ?, ?)",
+			cursor.matchRank, cursor.relationRank, cursor.followerCount, cursor.id)
+	}
+
+	// Fetch one extra row to tell whether there is another page.
+	var rows []userSearchRow
+	if err := query.
+		Order("match_rank desc, relation_rank desc, follower_count desc, id desc").
+		Limit(limit + 1).
+		Find(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to search users"})
+	}
+
+	response := UserSearchResponse{Users: make([]UserSummaryResponse, 0, len(rows))}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		response.NextCursor = searchCursor{last.MatchRank, last.RelationRank, last.FollowerCount, last.ID}.encode()
+	}
+	for _, r := range rows {
+		response.Users = append(response.Users, UserSummaryResponse{
+			ID:             r.ID,
+			Name:           r.Name,
+			Username:       r.Username,
+			ProfilePicture: r.ProfilePicture,
+			Bio:            r.Bio,
+			IsFollowing:    r.RelationRank&2 != 0,
+			FollowsYou:     r.RelationRank&1 != 0,
+		})
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"net/url"
+	"reflect"
+	"socialmedia/models"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// searchAs runs a user search as viewer and returns the page.
+func searchAs(t *testing.T, viewer models.User, query url.Values) UserSearchResponse {
+	t.Helper()
+	resp := getAs(t, SearchUsers, "/api/users/search", "/api/users/search?"+query.Encode(), viewer)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("search %s = %d", query.Encode(), resp.StatusCode)
+	}
+	var page UserSearchResponse
+	decodeJSON(t, resp, &page)
+	return page
+}
+
+func usernames(users []UserSummaryResponse) []string {
+	names := make([]string, len(users))
+	for i, u := range users {
+		names[i] = u.Username
+	}
+	return names
+}
+
+func TestSearchUsersRanking(t *testing.T) {
+	setupTestDB(t)
+	viewer := createTestUser(t, "viewer@example.com")
+	user := func(username, name string, followers int64) models.User {
+		return createTestUser(t, username+"@example.com", func(u *models.User) {
+			u.Username, u.Name, u.FollowerCount = username, name, followers
+		})
+	}
+	user("ann", "Someone", 0)
+	user("annabel", "Annabel", 5)
+	annie := user("annie", "Annie", 0)
+	annaM := user("anna_m", "Anna", 0)
+	user("annette", "Annette", 10)
+	user("maria", "Maria Anna", 7)
+	user("joanne", "Joanne", 100)
+	user("annika", "Annika", 5)
+	user("bob", "Bob", 0)
+	blocked := user("annblocked", "Ann", 0)
+	follows := []models.Follow{
+		{FollowerID: viewer.ID, FollowingID: annie.ID},
+		{FollowerID: viewer.ID, FollowingID: annaM.ID},
+		{FollowerID: annaM.ID, FollowingID: viewer.ID},
+	}
+	if err := models.DB.Create(&follows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := models.DB.Create(&models.Block{BlockerID: blocked.ID, BlockedID: viewer.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The exact username, then prefix matches with mutual follows, people
+	// the viewer follows and then by follower count and newest first, then
+	// names merely containing the term.
+	want := []string{"ann", "anna_m", "annie", "annette", "maria", "annika", "annabel", "joanne"}
+
+	page := searchAs(t, viewer, url.Values{"q": {"@Ann "}})
+	if got := usernames(page.Users); !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %v, want %v", got, want)
+	}
+	if page.NextCursor != "" {
+		t.Errorf("next cursor = %q on the only page", page.NextCursor)
+	}
+	if u := page.Users[1]; !u.IsFollowing || !u.FollowsYou {
+		t.Errorf("anna_m = %+v, want mutual follows", u)
+	}
+
+	// Paging through returns every result once, in the same order.
+	var got []string
+	query := url.Values{"q": {"ann"}, "limit": {"3"}}
+	for pages := 0; ; pages++ {
+		if pages == len(want) {
+			t.Fatal("too many pages")
+		}
+		page := searchAs(t, viewer, query)
+		if len(page.Users) == 0 || len(page.Users) > 3 {
+			t.Fatalf("page of %d users", len(page.Users))
+		}
+		got = append(got, usernames(page.Users)...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paged results = %v, want %v", got, want)
+	}
+
+	// A misspelling still finds the user through shared trigrams.
+	if got := usernames(searchAs(t, viewer, url.Values{"q": {"annabell"}}).Users); !reflect.DeepEqual(got, []string{"annabel"}) {
+		t.Errorf("fuzzy results = %v, want [annabel]", got)
+	}
+
+	resp := getAs(t, SearchUsers, "/api/users/search", "/api/users/search?q=ann&cursor=bogus", viewer)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("invalid cursor = %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"socialmedia/config"
+	"socialmedia/models"
+	"socialmedia/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// SessionResponse describes a logged-in device.
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// tokenPair holds the credentials handed to a client after authentication.
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// startSession records a new session for the requesting device and returns
+// a fresh access/refresh token pair bound to it.
+func startSession(c *fiber.Ctx, userID uint) (*tokenPair, error) {
+	refreshToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	session := models.Session{
+		UserID:           userID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		Device:           utils.DeviceFromUserAgent(userAgent),
+		IP:               c.IP(),
+		UserAgent:        userAgent,
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(config.RefreshTokenTTL),
+	}
+	if err := models.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, err := generateJWT(userID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// revokeSession marks a session as revoked so its access and refresh tokens
+// are no longer accepted.
+func revokeSession(sessionID uint) error {
+	return models.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeAllSessions revokes every active session of a user, logging them out
+// on all devices.
+func revokeAllSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RefreshToken godoc
+// @Summary Refresh an access token
+// @Description Exchange a refresh token for a new access token. The refresh token is rotated and the old one stops working; using it again revokes the session.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param refreshTokenInput body RefreshTokenInput true "Refresh token"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} AuthResponse
+// @Failure 401 {object} AuthResponse
+// @Failure 500 {object} AuthResponse
+// @Router /api/token/refresh [post]
+func RefreshToken(c *fiber.Ctx) error {
+	var input RefreshTokenInput
+	if err := c.BodyParser(&input); err != nil || input.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Refresh token is required",
+		})
+	}
+
+	var session models.Session
+	hash := utils.HashToken(input.RefreshToken)
+	if err := models.DB.Where("refresh_token_hash = ?", hash).First(&session).Error; err != nil {
+		// A refresh token that was already rotated out has been copied;
+		// revoke its session so neither copy can be used any more.
+		if err := models.DB.Where("previous_token_hash = ?", hash).First(&session).Error; err == nil {
+			if err := revokeSession(session.ID); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+					Status:  "error",
+					Message: "Could not revoke session",
+				})
+			}
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Invalid refresh token",
+		})
+	}
+
+	now := time.Now()
+	if !session.IsActive(now) {
+		return c.Status(fiber.StatusUnauthorized).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Session has expired or been revoked",
+		})
+	}
+
+	// Rotate the refresh token so each one can only be used once.
+	refreshToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not create token",
+		})
+	}
+
+	// Guard on the old hash so two concurrent refreshes cannot both succeed.
+	result := models.DB.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ?", session.ID, session.RefreshTokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  utils.HashToken(refreshToken),
+			"previous_token_hash": session.RefreshTokenHash,
+			"ip":                  c.IP(),
+			"user_agent":          c.Get(fiber.HeaderUserAgent),
+			"last_seen_at":        now,
+			"expires_at":          now.Add(config.RefreshTokenTTL),
+		})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not refresh session",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Invalid refresh token",
+		})
+	}
+
+	accessToken, err := generateJWT(session.UserID, session.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not create token",
+		})
+	}
+
+	return c.JSON(AuthResponse{
+		Status:       "success",
+		Message:      "Token refreshed",
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(config.AccessTokenTTL.Seconds()),
+	})
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List the devices the authenticated user is currently logged in on
+// @Tags Auth
+// @Produce json
+// @Success 200 {array} SessionResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/sessions [get]
+// @Security ApiKeyAuth
+func ListSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	currentSessionID, _ := c.Locals("session_id").(uint)
+
+	var sessions []models.Session
+	if err := models.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").
+		Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch sessions"})
+	}
+
+	response := make([]SessionResponse, len(sessions))
+	for i, s := range sessions {
+		response[i] = SessionResponse{
+			ID:         s.ID,
+			Device:     s.Device,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == currentSessionID,
+		}
+	}
+	return c.JSON(response)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Log out a single device by revoking its session
+// @Tags Auth
+// @Produce json
+// @Param id path int true "Session ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/sessions/{id} [delete]
+// @Security ApiKeyAuth
+func RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	sessionID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid session ID"})
+	}
+
+	var session models.Session
+	if err := models.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Session not found"})
+	}
+
+	if err := revokeSession(session.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to revoke session"})
+	}
+
+	return c.JSON(MessageResponse{Message: "Session revoked"})
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"net/http"
+	"socialmedia/models"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	app, _ := newLoginTest(t)
+	app.Post("/api/token/refresh", RefreshToken)
+	user := createLoginUser(t, "alice@example.com", false)
+	authed := newScopedApp()
+
+	_, login := postJSON(t, app, "/api/login", LoginInput{Email: user.Email, Password: testPassword})
+	if login.RefreshToken == "" {
+		t.Fatalf("login = %+v", login)
+	}
+
+	resp, refreshed := postJSON(t, app, "/api/token/refresh", RefreshTokenInput{RefreshToken: login.RefreshToken})
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("refresh status = %d", resp.StatusCode)
+	}
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == login.RefreshToken {
+		t.Fatalf("refresh token was not rotated: %+v", refreshed)
+	}
+	if status := requestWithToken(t, authed, http.MethodGet, "/api/sessions", refreshed.Token); status != fiber.StatusOK {
+		t.Fatalf("refreshed access token = %d, want 200", status)
+	}
+
+	// Presenting the old refresh token again means it was copied; the
+	// session is revoked along with every token it handed out.
+	resp, _ = postJSON(t, app, "/api/token/refresh", RefreshTokenInput{RefreshToken: login.RefreshToken})
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("reusing a refresh token = %d, want 401", resp.StatusCode)
+	}
+	var session models.Session
+	if err := models.DB.Where("user_id = ?", user.ID).First(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	if session.RevokedAt == nil {
+		t.Error("session still active after its refresh token was reused")
+	}
+	resp, _ = postJSON(t, app, "/api/token/refresh", RefreshTokenInput{RefreshToken: refreshed.RefreshToken})
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("current refresh token after reuse = %d, want 401", resp.StatusCode)
+	}
+	if status := requestWithToken(t, authed, http.MethodGet, "/api/sessions", refreshed.Token); status != fiber.StatusUnauthorized {
+		t.Errorf("access token after reuse = %d, want 401", status)
+	}
+
+	// An unknown refresh token revokes nothing.
+	_, other := postJSON(t, app, "/api/login", LoginInput{Email: user.Email, Password: testPassword})
+	resp, _ = postJSON(t, app, "/api/token/refresh", RefreshTokenInput{RefreshToken: "unknown"})
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("unknown refresh token = %d, want 401", resp.StatusCode)
+	}
+	if status := requestWithToken(t, authed, http.MethodGet, "/api/sessions", other.Token); status != fiber.StatusOK {
+		t.Errorf("other session after an unknown token = %d, want 200", status)
+	}
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"socialmedia/config"
+	"socialmedia/models"
+	"socialmedia/services/suggestions"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SuggestedUserResponse is a user the caller might want to follow.
+// FollowedByCount is how many of the people the caller follows follow them.
+type SuggestedUserResponse struct {
+	UserSummaryResponse
+	FollowedByCount int64 `json:"followed_by_count"`
+}
+
+// SuggestionListResponse is a list of follow suggestions, best first.
+type SuggestionListResponse struct {
+	Users []SuggestedUserResponse `json:"users"`
+}
+
+// GetSuggestions godoc
+// @Summary Who to follow
+// @Description Suggest users to follow, best first. Candidates are scored by how many of the people you follow follow them, how many posts you have both liked or commented on, and how active they have been lately; people you follow, have asked to follow, blocked or muted are left out. Suggestions are cached and recomputed periodically.
+// @Tags User
+// @Produce json
+// @Param limit query int false "Number of suggestions (default: 10, max 50)"
+// @Success 200 {object} SuggestionListResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/suggestions [get]
+// @Security ApiKeyAuth
+func GetSuggestions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limit < 1 || limit > suggestions.CacheSize {
+		limit = 10
+	}
+
+	entries, err := suggestions.ForUser(models.DB, userID, config.SuggestionsTTL, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch suggestions"})
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	ids := make([]uint, len(entries))
+	for i, e := range entries {
+		ids[i] = e.SuggestedID
+	}
+	var users []models.User
+	if len(ids) > 0 {
+		if err := models.DB.Where("id IN ?", ids).Find(&users).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch suggestions"})
+		}
+	}
+	byID := make(map[uint]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	_, followers, err := followRelations(userID, ids)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch suggestions"})
+	}
+
+	response := SuggestionListResponse{Users: make([]SuggestedUserResponse, 0, len(entries))}
+	for _, e := range entries {
+		u, ok := byID[e.SuggestedID]
+		if !ok {
+			continue
+		}
+		response.Users = append(response.Users, SuggestedUserResponse{
+			UserSummaryResponse: UserSummaryResponse{
+				ID:             u.ID,
+				Name:           u.Name,
+				Username:       u.Username,
+				ProfilePicture: u.ProfilePicture,
+				Bio:            u.Bio,
+				FollowsYou:     followers[u.ID],
+			},
+			FollowedByCount: e.FollowedBy,
+		})
+	}
+	return c.JSON(response)
+}
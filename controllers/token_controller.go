@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"socialmedia/models"
+	"socialmedia/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultTokenLifetimeDays = 90
+	maxTokenLifetimeDays     = 365
+)
+
+type CreateTokenInput struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays defaults to 90 and may be at most 365.
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+type UpdateTokenInput struct {
+	Name string `json:"name"`
+}
+
+// TokenResponse describes a personal access token. Token is only set in the
+// response to its creation; it cannot be retrieved later.
+type TokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newTokenResponse(t models.PersonalAccessToken) TokenResponse {
+	return TokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Hint:       t.Hint,
+		Scopes:     t.ScopeList(),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+// ListTokens godoc
+// @Summary List personal access tokens
+// @Description List the authenticated user's personal access tokens
+// @Tags Tokens
+// @Produce json
+// @Success 200 {array} TokenResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/tokens [get]
+// @Security ApiKeyAuth
+func ListTokens(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var tokens []models.PersonalAccessToken
+	if err := models.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch tokens"})
+	}
+
+	response := make([]TokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		response = append(response, newTokenResponse(t))
+	}
+	return c.JSON(response)
+}
+
+// CreateToken godoc
+// @Summary Create a personal access token
+// @Description Create a token for scripts and integrations. Send it as "Authorization: Bearer <token>". The token is only shown once.
+// @Tags Tokens
+// @Accept json
+// @Produce json
+// @Param createTokenInput body CreateTokenInput true "Token name, scopes and lifetime"
+// @Success 201 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/tokens [post]
+// @Security ApiKeyAuth
+func CreateToken(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var input CreateTokenInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request payload"})
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Name is required"})
+	}
+	if len(input.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "At least one scope is required"})
+	}
+	for _, scope := range input.Scopes {
+		if !models.IsValidTokenScope(scope) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Unknown scope " + scope + "; valid scopes are " + strings.Join(models.TokenScopes, ", "),
+			})
+		}
+	}
+	if input.ExpiresInDays == 0 {
+		input.ExpiresInDays = defaultTokenLifetimeDays
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxTokenLifetimeDays {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "expires_in_days must be between 1 and " + strconv.Itoa(maxTokenLifetimeDays),
+		})
+	}
+
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Could not create token"})
+	}
+	token := models.PersonalAccessTokenPrefix + secret
+
+	expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+	pat := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      input.Name,
+		TokenHash: utils.HashToken(token),
+		Hint:      token[:len(models.PersonalAccessTokenPrefix)+4],
+		Scopes:    strings.Join(input.Scopes, " "),
+		ExpiresAt: &expiresAt,
+	}
+	if err := models.DB.Create(&pat).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Could not create token"})
+	}
+
+	response := newTokenResponse(pat)
+	response.Token = token
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// GetToken godoc
+// @Summary Get a personal access token
+// @Description Get a personal access token's details. The secret itself is not returned.
+// @Tags Tokens
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/tokens/{id} [get]
+// @Security ApiKeyAuth
+func GetToken(c *fiber.Ctx) error {
+	pat, ok := findToken(c)
+	if !ok {
+		return nil
+	}
+	return c.JSON(newTokenResponse(*pat))
+}
+
+// UpdateToken godoc
+// @Summary Rename a personal access token
+// @Tags Tokens
+// @Accept json
+// @Produce json
+// @Param id path int true "Token ID"
+// @Param updateTokenInput body UpdateTokenInput true "New name"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/tokens/{id} [patch]
+// @Security ApiKeyAuth
+func UpdateToken(c *fiber.Ctx) error {
+	pat, ok := findToken(c)
+	if !ok {
+		return nil
+	}
+
+	var input UpdateTokenInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request payload"})
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Name is required"})
+	}
+
+	if err := models.DB.Model(pat).Update("name", input.Name).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update token"})
+	}
+	return c.JSON(newTokenResponse(*pat))
+}
+
+// DeleteToken godoc
+// @Summary Revoke a personal access token
+// @Tags Tokens
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/tokens/{id} [delete]
+// @Security ApiKeyAuth
+func DeleteToken(c *fiber.Ctx) error {
+	pat, ok := findToken(c)
+	if !ok {
+		return nil
+	}
+	if err := models.DB.Delete(pat).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to revoke token"})
+	}
+	return c.JSON(MessageResponse{Message: "Token revoked"})
+}
+
+// findToken loads the token named by the :id parameter if it belongs to the
+// authenticated user. When it returns false the error response has already
+// been written.
+func findToken(c *fiber.Ctx) (*models.PersonalAccessToken, bool) {
+	userID := c.Locals("user_id").(uint)
+	tokenID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid token ID"})
+		return nil, false
+	}
+
+	var pat models.PersonalAccessToken
+	if err := models.DB.Where("id = ? AND user_id = ?", tokenID, userID).First(&pat).Error; err != nil {
+		c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Token not found"})
+		return nil, false
+	}
+	return &pat, true
+}
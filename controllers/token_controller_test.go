@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"socialmedia/middlewares"
+	"socialmedia/models"
+	"socialmedia/utils"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// createTestToken stores a personal access token for user with the given
+// space-separated scopes and returns it.
+func createTestToken(t *testing.T, user models.User, scopes string, expiresAt time.Time) (models.PersonalAccessToken, string) {
+	t.Helper()
+	token := models.PersonalAccessTokenPrefix + strconv.Itoa(int(time.Now().UnixNano()))
+	pat := models.PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      "test",
+		TokenHash: utils.HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: &expiresAt,
+	}
+	if err := models.DB.Create(&pat).Error; err != nil {
+		t.Fatal(err)
+	}
+	return pat, token
+}
+
+// newScopedApp serves a read and a write route for the posts scope and an
+// account route that needs a session, behind the real authentication.
+func newScopedApp() *fiber.App {
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app := fiber.New()
+	app.Use(middlewares.JWTMiddleware)
+	app.Get("/api/posts", middlewares.RequireScope("posts"), ok)
+	app.Post("/api/posts", middlewares.RequireScope("posts"), ok)
+	app.Get("/api/sessions", middlewares.RequireSession, ok)
+	return app
+}
+
+func requestWithToken(t *testing.T, app *fiber.App, method, path, token string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice@example.com")
+	app := newScopedApp()
+	later := time.Now().Add(time.Hour)
+	_, reader := createTestToken(t, user, "posts:read", later)
+	_, writer := createTestToken(t, user, "posts:write", later)
+	_, other := createTestToken(t, user, "comments:write", later)
+	_, expired := createTestToken(t, user, "posts:write", time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name, method, path, token string
+		want                      int
+	}{
+		{"read with read scope", http.MethodGet, "/api/posts", reader, fiber.StatusOK},
+		{"write with read scope", http.MethodPost, "/api/posts", reader, fiber.StatusForbidden},
+		{"read with write scope", http.MethodGet, "/api/posts", writer, fiber.StatusOK},
+		{"write with write scope", http.MethodPost, "/api/posts", writer, fiber.StatusOK},
+		{"another resource's scope", http.MethodGet, "/api/posts", other, fiber.StatusForbidden},
+		{"account route", http.MethodGet, "/api/sessions", writer, fiber.StatusForbidden},
+		{"expired", http.MethodGet, "/api/posts", expired, fiber.StatusUnauthorized},
+		{"unknown", http.MethodGet, "/api/posts", models.PersonalAccessTokenPrefix + "unknown", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := requestWithToken(t, app, tt.method, tt.path, tt.token); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPersonalAccessTokenRevocation(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice@example.com")
+	app := newScopedApp()
+	pat, token := createTestToken(t, user, "posts:write", time.Now().Add(time.Hour))
+	if got := requestWithToken(t, app, http.MethodGet, "/api/posts", token); got != fiber.StatusOK {
+		t.Fatalf("status before revoking = %d", got)
+	}
+
+	resp := deleteAs(t, DeleteToken, "/api/tokens/:id", "/api/tokens/"+strconv.Itoa(int(pat.ID)), user)
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK && resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("DeleteToken status = %d", resp.StatusCode)
+	}
+	if got := requestWithToken(t, app, http.MethodGet, "/api/posts", token); got != fiber.StatusUnauthorized {
+		t.Errorf("status after revoking = %d, want 401", got)
+	}
+
+	// Suspending the owner stops every token too.
+	_, token = createTestToken(t, user, "posts:write", time.Now().Add(time.Hour))
+	if err := models.DB.Model(&user).Update("suspended_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := requestWithToken(t, app, http.MethodGet, "/api/posts", token); got != fiber.StatusForbidden {
+		t.Errorf("status for a suspended owner = %d, want 403", got)
+	}
+}
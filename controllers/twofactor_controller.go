@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"socialmedia/config"
+	"socialmedia/keyring"
+	"socialmedia/models"
+	"socialmedia/services/loginguard"
+	"socialmedia/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	challengeTokenTTL = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code"`
+}
+
+type PasswordConfirmInput struct {
+	Password string `json:"password"`
+}
+
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	// Code is either a current TOTP code or an unused recovery code.
+	Code string `json:"code"`
+}
+
+// generateChallengeToken issues a short-lived token proving the password
+// step of a two-factor login succeeded. It cannot be used as an access token.
+func generateChallengeToken(userID uint) (string, error) {
+	claims := jwt.MapClaims{
+		"typ":     "2fa_challenge",
+		"iss":     keyring.Issuer(),
+		"aud":     keyring.AudienceChallenge,
+		"user_id": userID,
+		"exp":     time.Now().Add(challengeTokenTTL).Unix(),
+	}
+	return keyring.Sign(claims)
+}
+
+// parseChallengeToken validates a challenge token and returns its user ID.
+func parseChallengeToken(tokenStr string) (uint, error) {
+	claims := jwt.MapClaims{}
+	token, err := keyring.ParseFor(tokenStr, claims, keyring.AudienceChallenge)
+	if err != nil || !token.Valid {
+		return 0, errors.New("invalid challenge token")
+	}
+	if claims["typ"] != "2fa_challenge" {
+		return 0, errors.New("invalid challenge token")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errors.New("invalid challenge token")
+	}
+	return uint(userID), nil
+}
+
+// replaceRecoveryCodes discards a user's recovery codes and returns a fresh set.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(b)
+		codes[i] = raw[:5] + "-" + raw[5:]
+
+		if err := tx.Create(&models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(normalizeRecoveryCode(codes[i])),
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// verifySecondFactor accepts either a TOTP code, which may only be used once,
+// or an unused recovery code, which is consumed.
+func verifySecondFactor(user models.User, code string) (bool, error) {
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		result := models.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return result.RowsAffected == 1, result.Error
+	}
+
+	result := models.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// SetupTwoFactor godoc
+// @Summary Start two-factor enrolment
+// @Description Generate a new TOTP secret and otpauth URI for an authenticator app. Two-factor authentication is not enforced until it is confirmed with /api/2fa/enable.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} TwoFactorSetupResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/2fa/setup [post]
+// @Security ApiKeyAuth
+func SetupTwoFactor(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if user.TwoFactorEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Two-factor authentication is already enabled"})
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Could not generate secret"})
+	}
+
+	if err := models.DB.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Could not save secret"})
+	}
+
+	return c.JSON(TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(secret, user.Email, config.AppName),
+	})
+}
+
+// EnableTwoFactor godoc
+// @Summary Confirm two-factor enrolment
+// @Description Enable two-factor authentication by submitting a code from the authenticator app. Returns one-time recovery codes that are only shown once.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body TwoFactorCodeInput true "Current TOTP code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/2fa/enable [post]
+// @Security ApiKeyAuth
+func EnableTwoFactor(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if user.TwoFactorEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Two-factor authentication is already enabled"})
+	}
+	if user.TOTPSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Call /api/2fa/setup first"})
+	}
+
+	var input TwoFactorCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, input.Code, time.Now())
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid code"})
+	}
+
+	var codes []string
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_enabled": true,
+			"totp_last_step":     step,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Could not enable two-factor authentication"})
+	}
+
+	return c.JSON(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable two-factor authentication
+// @Description Turn off two-factor authentication. Requires the current password.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body PasswordConfirmInput true "Current password"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/2fa/disable [post]
+// @Security ApiKeyAuth
+func DisableTwoFactor(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if !user.TwoFactorEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Two-factor authentication is not enabled"})
+	}
+
+	var input PasswordConfirmInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Incorrect password"})
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_enabled": false,
+			"totp_secret":        "",
+			"totp_last_step":     0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Could not disable two-factor authentication"})
+	}
+
+	return c.JSON(MessageResponse{Message: "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes with a new set. Requires the current password.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body PasswordConfirmInput true "Current password"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/2fa/recovery-codes [post]
+// @Security ApiKeyAuth
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if !user.TwoFactorEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Two-factor authentication is not enabled"})
+	}
+
+	var input PasswordConfirmInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Incorrect password"})
+	}
+
+	var codes []string
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Could not generate recovery codes"})
+	}
+
+	return c.JSON(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// LoginTwoFactor godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the challenge token returned by /api/login and a TOTP or recovery code for an access token
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body TwoFactorLoginInput true "Challenge token and code"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} AuthResponse
+// @Failure 401 {object} AuthResponse
+// @Failure 429 {object} AuthResponse
+// @Failure 500 {object} AuthResponse
+// @Router /api/login/2fa [post]
+func LoginTwoFactor(guard *loginguard.Guard) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input TwoFactorLoginInput
+		if err := c.BodyParser(&input); err != nil || input.ChallengeToken == "" || input.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Challenge token and code are required",
+			})
+		}
+
+		userID, err := parseChallengeToken(input.ChallengeToken)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Invalid or expired challenge token",
+			})
+		}
+
+		var user models.User
+		if err := models.DB.First(&user, userID).Error; err != nil || !user.TwoFactorEnabled {
+			return c.Status(fiber.StatusUnauthorized).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Invalid or expired challenge token",
+			})
+		}
+		if user.IsSuspended() {
+			return c.Status(fiber.StatusForbidden).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Account suspended",
+			})
+		}
+
+		// Codes are short, so guessing them is throttled like passwords.
+		attempt := loginguard.Attempt{Email: user.Email, IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent), UserID: &user.ID}
+		wait, err := guard.Check(attempt)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Could not process login",
+			})
+		}
+		if wait > 0 {
+			return tooManyAttempts(c, wait)
+		}
+
+		ok, err := verifySecondFactor(user, input.Code)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+				Status:  "error",
+				Message: "Could not verify code",
+			})
+		}
+		if !ok {
+			return loginFailed(c, guard, attempt, loginguard.ReasonInvalidCode, "Invalid code")
+		}
+
+		if err := guard.Succeed(user.Email); err != nil {
+			log.Printf("Could not reset login failures for user %d: %v", user.ID, err)
+		}
+		return completeLogin(c, user)
+	}
+}
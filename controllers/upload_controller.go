@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"socialmedia/config"
+	"socialmedia/models"
+	"socialmedia/services/storage"
+	"socialmedia/utils"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// errUploadCompleted reports a race with another request completing the
+// same upload.
+var errUploadCompleted = errors.New("upload already completed")
+
+// CreateUploadInput describes a file the client is about to upload.
+type CreateUploadInput struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// UploadResponse tells the client where to send the file: an HTTP request
+// with Method to URL before ExpiresAt. A PUT carries the file as its body,
+// with Headers; a POST is a multipart form of Fields followed by the file
+// in a "file" field.
+type UploadResponse struct {
+	ID        uint              `json:"id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// CompleteUploadInput carries the alt text of the media an upload becomes.
+type CompleteUploadInput struct {
+	AltText string `json:"alt_text"`
+}
+
+// CreateUpload godoc
+// @Summary Start a direct upload
+// @Description Get a URL to upload a file to directly, without sending it through the API: a presigned form POST on S3-compatible storage, admitting only a file of the given type within the upload size limit, or otherwise a PUT of exactly the given size to an API endpoint authorised by a token in the URL. Send the file with the returned method, headers and form fields, then complete the upload to turn it into media.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param createUploadInput body CreateUploadInput true "Content type and size in bytes of the file"
+// @Success 201 {object} UploadResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/uploads [post]
+// @Security ApiKeyAuth
+func CreateUpload(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var input CreateUploadInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+	input.ContentType = strings.ToLower(strings.TrimSpace(input.ContentType))
+	if !isAllowedUpload(input.ContentType) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: mediaErrorMessage(errUnsupportedMedia)})
+	}
+	if input.Size <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Size must be positive"})
+	}
+	if input.Size > config.MaxUploadSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(ErrorResponse{Error: mediaErrorMessage(errFileTooLarge)})
+	}
+	// The stored size is only known once the file is processed, so this
+	// just turns away uploads that cannot fit.
+	if config.UserStorageQuota > 0 && user.StorageUsed+input.Size > config.UserStorageQuota {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(ErrorResponse{Error: mediaErrorMessage(errQuotaExceeded)})
+	}
+
+	var open int64
+	if err := models.DB.Model(&models.Upload{}).
+		Where("user_id = ? AND completed_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Count(&open).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to start upload"})
+	}
+	if open >= int64(config.MaxOpenUploads) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{Error: "Too many uploads in progress; complete them or wait for them to expire"})
+	}
+
+	key, err := storage.NewKey("uploads", input.ContentType)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to start upload"})
+	}
+	upload := models.Upload{
+		UserID:      user.ID,
+		StorageKey:  key,
+		ContentType: input.ContentType,
+		Size:        input.Size,
+		ExpiresAt:   time.Now().Add(config.UploadURLExpiry),
+	}
+
+	var uploadURL, token string
+	var fields map[string]string
+	if presigner, ok := storage.Current().(storage.Presigner); ok {
+		uploadURL, fields, err = presigner.PresignedPost(c.UserContext(), key, input.ContentType, config.MaxUploadSize, config.UploadURLExpiry)
+	} else {
+		token, err = utils.GenerateSecureToken(32)
+		upload.TokenHash = utils.HashToken(token)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to start upload"})
+	}
+	if err := models.DB.Create(&upload).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to start upload"})
+	}
+	resp := UploadResponse{
+		ID:        upload.ID,
+		Method:    fiber.MethodPost,
+		URL:       uploadURL,
+		Fields:    fields,
+		ExpiresAt: upload.ExpiresAt,
+	}
+	if token != "" {
+		resp.Method = fiber.MethodPut
+		resp.URL = fmt.Sprintf("%s/api/uploads/%d?token=%s", config.APIURL, upload.ID, token)
+		resp.Headers = map[string]string{fiber.HeaderContentType: upload.ContentType}
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// ReceiveUpload godoc
+// @Summary Receive a direct upload
+// @Description Upload the file for an upload session to the URL returned when starting it. Used when the storage backend cannot take uploads directly; the token in the URL authorises the request. The file must be the size given when starting the upload.
+// @Tags posts
+// @Accept octet-stream
+// @Produce json
+// @Param id path int true "Upload ID"
+// @Param token query string true "Upload token"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/uploads/{id} [put]
+func ReceiveUpload(c *fiber.Ctx) error {
+	token := c.Query("token")
+	var upload models.Upload
+	if token == "" || models.DB.Where("id = ? AND token_hash = ? AND expires_at > ?",
+		c.Params("id"), utils.HashToken(token), time.Now()).First(&upload).Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Upload not found or expired"})
+	}
+	if upload.CompletedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Upload already completed"})
+	}
+
+	body := c.Body()
+	if int64(len(body)) > config.MaxUploadSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(ErrorResponse{Error: mediaErrorMessage(errFileTooLarge)})
+	}
+	if int64(len(body)) != upload.Size {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: fmt.Sprintf("The file must be %d bytes, as given when starting the upload", upload.Size)})
+	}
+	obj, err := storage.Current().Put(c.UserContext(), upload.StorageKey, bytes.NewReader(body), int64(len(body)), upload.ContentType)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to store upload"})
+	}
+	// Some backends pick their own keys.
+	if obj.Key != upload.StorageKey {
+		if err := models.DB.Model(&upload).Update("storage_key", obj.Key).Error; err != nil {
+			storage.Current().Delete(c.UserContext(), obj.Key)
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to store upload"})
+		}
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CompleteUpload godoc
+// @Summary Complete a direct upload
+// @Description Check the file sent for an upload session and record it as media, ready to attach to a post by ID. The file is read back in full and goes through the same checks and processing as POST /api/media, and the result is stored anew before the uploaded copy is deleted. Media not attached to a post within PENDING_MEDIA_TTL is deleted. Completing an upload again returns the same media.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path int true "Upload ID"
+// @Param completeUploadInput body CompleteUploadInput false "Alt text (max 255 characters)"
+// @Success 201 {object} models.Media
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/uploads/{id}/complete [post]
+// @Security ApiKeyAuth
+func CompleteUpload(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid upload ID"})
+	}
+
+	var input CompleteUploadInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+		}
+	}
+	input.AltText = strings.TrimSpace(input.AltText)
+	if utf8.RuneCountInString(input.AltText) > maxAltTextLength {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: mediaErrorMessage(errAltTextTooLong)})
+	}
+
+	var upload models.Upload
+	if err := models.DB.Where("id = ? AND user_id = ?", id, userID).First(&upload).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Upload not found"})
+	}
+	if upload.CompletedAt != nil {
+		var media models.Media
+		if upload.MediaID == nil || models.DB.Preload("Variants", models.VariantsBySize).First(&media, *upload.MediaID).Error != nil {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Upload not found"})
+		}
+		return c.JSON(media)
+	}
+	if upload.ExpiresAt.Before(time.Now()) {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Upload not found"})
+	}
+
+	body, err := storage.Current().Get(c.UserContext(), upload.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "The file has not been uploaded yet"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to read upload"})
+	}
+	defer body.Close()
+
+	media := models.Media{UserID: userID, AltText: input.AltText}
+	var stored []string
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if stored, err = saveMedia(c.UserContext(), tx, &media, body); err != nil {
+			return err
+		}
+		// Only the first request to get here completes the upload.
+		result := tx.Model(&upload).Where("completed_at IS NULL").
+			Updates(map[string]interface{}{"completed_at": time.Now(), "media_id": media.ID})
+		if result.Error != nil {
+			return fmt.Errorf("%w: %v", errSaveMedia, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errUploadCompleted
+		}
+		return nil
+	})
+	// Media that was not saved leaves none of its files behind.
+	if err != nil {
+		storage.DeleteAll(c.UserContext(), stored)
+	}
+	// The file is stored again as media, rejected, or was stored by a
+	// request that completed the upload first; either way the uploaded copy
+	// is no longer needed.
+	if err == nil || errors.Is(err, errUploadCompleted) || mediaErrorMessage(err) != "" {
+		storage.Current().Delete(c.UserContext(), upload.StorageKey)
+	}
+	if errors.Is(err, errUploadCompleted) {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Upload already completed"})
+	}
+	if msg := mediaErrorMessage(err); msg != "" {
+		return c.Status(mediaErrorStatus(err)).JSON(ErrorResponse{Error: msg})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to save media"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(media)
+}
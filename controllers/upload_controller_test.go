@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"socialmedia/config"
+	"socialmedia/internal/testutil"
+	"socialmedia/models"
+	"socialmedia/services/uploads"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func newUploadApp(user models.User) *fiber.App {
+	app := fiber.New()
+	app.Put("/api/uploads/:id", ReceiveUpload)
+	app.Post("/api/uploads", asUser(user), CreateUpload)
+	app.Post("/api/uploads/:id/complete", asUser(user), CompleteUpload)
+	return app
+}
+
+func doRequest(t *testing.T, app *fiber.App, method, target string, body []byte) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// createUpload starts an upload of size bytes of PNG and returns it, with
+// the path and query of its upload URL.
+func createUpload(t *testing.T, app *fiber.App, size int) (UploadResponse, string) {
+	t.Helper()
+	body, _ := json.Marshal(CreateUploadInput{ContentType: "image/png", Size: int64(size)})
+	resp := doRequest(t, app, http.MethodPost, "/api/uploads", body)
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("CreateUpload status = %d", resp.StatusCode)
+	}
+	var upload UploadResponse
+	decodeJSON(t, resp, &upload)
+	u, err := url.Parse(upload.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return upload, u.RequestURI()
+}
+
+func TestUploadLifecycle(t *testing.T) {
+	setupTestDB(t)
+	dir := testutil.UseStorage(t).Dir
+	user := createTestUser(t, "alice@example.com")
+	app := newUploadApp(user)
+	data := testPNG(t)
+
+	upload, target := createUpload(t, app, len(data))
+	if upload.Method != fiber.MethodPut || upload.Headers[fiber.HeaderContentType] != "image/png" || upload.Fields != nil {
+		t.Errorf("upload = %+v, want a PUT of image/png", upload)
+	}
+	complete := "/api/uploads/" + strconv.Itoa(int(upload.ID)) + "/complete"
+
+	if resp := doRequest(t, app, http.MethodPost, complete, nil); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("completing before the file is sent = %d, want 400", resp.StatusCode)
+	}
+	if resp := doRequest(t, app, http.MethodPut, "/api/uploads/"+strconv.Itoa(int(upload.ID))+"?token=wrong", data); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("sending with a wrong token = %d, want 404", resp.StatusCode)
+	}
+	if resp := doRequest(t, app, http.MethodPut, target, data[:len(data)-1]); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("sending fewer bytes than declared = %d, want 400", resp.StatusCode)
+	}
+	if resp := doRequest(t, app, http.MethodPut, target, append(data, 0)); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("sending more bytes than declared = %d, want 400", resp.StatusCode)
+	}
+	if resp := doRequest(t, app, http.MethodPut, target, data); resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("sending the file = %d, want 204", resp.StatusCode)
+	}
+
+	resp := doRequest(t, app, http.MethodPost, complete, []byte(`{"alt_text":"A test"}`))
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("CompleteUpload status = %d", resp.StatusCode)
+	}
+	var media models.Media
+	decodeJSON(t, resp, &media)
+	if media.AltText != "A test" || media.Type != models.ImageType || len(media.Variants) == 0 {
+		t.Errorf("media = %+v", media)
+	}
+	// Only the media's files are left; the uploaded copy is gone.
+	if got, want := countFiles(t, dir), 1+len(media.Variants); got != want {
+		t.Errorf("files = %d, want %d", got, want)
+	}
+
+	// Completing again returns the same media.
+	resp = doRequest(t, app, http.MethodPost, complete, nil)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("completing again = %d, want 200", resp.StatusCode)
+	}
+	var again models.Media
+	decodeJSON(t, resp, &again)
+	if again.ID != media.ID {
+		t.Errorf("completing again = media %d, want %d", again.ID, media.ID)
+	}
+	if n := countRows(t, &models.Media{}); n != 1 {
+		t.Errorf("media = %d, want 1", n)
+	}
+	if resp := doRequest(t, app, http.MethodPut, target, data); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("sending after completion = %d, want 409", resp.StatusCode)
+	}
+
+	// An upload that expires can no longer be sent or completed.
+	expiring, expiringTarget := createUpload(t, app, len(data))
+	if resp := doRequest(t, app, http.MethodPut, expiringTarget, data); resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("sending the file = %d, want 204", resp.StatusCode)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := models.DB.Model(&models.Upload{}).Where("id = ?", expiring.ID).Update("expires_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	if resp := doRequest(t, app, http.MethodPut, expiringTarget, data); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("sending after expiry = %d, want 404", resp.StatusCode)
+	}
+	if resp := doRequest(t, app, http.MethodPost, "/api/uploads/"+strconv.Itoa(int(expiring.ID))+"/complete", nil); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("completing after expiry = %d, want 404", resp.StatusCode)
+	}
+
+	// Sweeping removes the expired upload and its file, and keeps the
+	// completed upload's media until it has waited too long for a post.
+	if err := models.DB.Model(&models.Upload{}).Where("id = ?", upload.ID).Update("expires_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	removed, err := uploads.Sweep(context.Background(), models.DB, time.Now(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want both uploads", removed)
+	}
+	if n := countRows(t, &models.Upload{}); n != 0 {
+		t.Errorf("uploads = %d, want none", n)
+	}
+	if got, want := countFiles(t, dir), 1+len(media.Variants); got != want {
+		t.Errorf("files after sweeping = %d, want %d", got, want)
+	}
+	if _, err := uploads.Sweep(context.Background(), models.DB, time.Now().Add(2*time.Hour), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, &models.Media{}); n != 0 {
+		t.Errorf("media after the pending TTL = %d, want none", n)
+	}
+	if got := countFiles(t, dir); got != 0 {
+		t.Errorf("files after the pending TTL = %d, want none", got)
+	}
+}
+
+func TestCompleteUploadConcurrently(t *testing.T) {
+	setupTestDB(t)
+	dir := testutil.UseStorage(t).Dir
+	user := createTestUser(t, "alice@example.com")
+	app := newUploadApp(user)
+	data := testPNG(t)
+
+	upload, target := createUpload(t, app, len(data))
+	if resp := doRequest(t, app, http.MethodPut, target, data); resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("sending the file = %d, want 204", resp.StatusCode)
+	}
+
+	// Complete the upload elsewhere just before this request records it.
+	raced := false
+	err := models.DB.Callback().Update().Before("gorm:update").Register("test:race", func(db *gorm.DB) {
+		if raced || db.Statement.Schema == nil || db.Statement.Schema.Table != "uploads" {
+			return
+		}
+		raced = true
+		err := db.Session(&gorm.Session{NewDB: true}).Model(&models.Upload{}).
+			Where("id = ?", upload.ID).UpdateColumn("completed_at", time.Now()).Error
+		if err != nil {
+			t.Errorf("completing the upload: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := doRequest(t, app, http.MethodPost, "/api/uploads/"+strconv.Itoa(int(upload.ID))+"/complete", nil)
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Fatalf("CompleteUpload status = %d, want 409", resp.StatusCode)
+	}
+	if !raced {
+		t.Fatal("no concurrent completion")
+	}
+	if n := countRows(t, &models.Media{}); n != 0 {
+		t.Errorf("media = %d, want none", n)
+	}
+	// Neither the uploaded copy nor the media's files are left.
+	if got := countFiles(t, dir); got != 0 {
+		t.Errorf("files = %d, want none", got)
+	}
+}
+
+func TestCreateUploadLimitsOpenUploads(t *testing.T) {
+	setupTestDB(t)
+	testutil.UseStorage(t)
+	user := createTestUser(t, "alice@example.com")
+	app := newUploadApp(user)
+
+	prev := config.MaxOpenUploads
+	config.MaxOpenUploads = 2
+	t.Cleanup(func() { config.MaxOpenUploads = prev })
+
+	first, _ := createUpload(t, app, 100)
+	createUpload(t, app, 100)
+	body, _ := json.Marshal(CreateUploadInput{ContentType: "image/png", Size: 100})
+	if resp := doRequest(t, app, http.MethodPost, "/api/uploads", body); resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("third open upload = %d, want 429", resp.StatusCode)
+	}
+
+	// Expired uploads no longer count.
+	if err := models.DB.Model(&models.Upload{}).Where("id = ?", first.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	createUpload(t, app, 100)
+}
@@ -1,24 +1,45 @@
 package controllers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"socialmedia/config"
 	"socialmedia/models"
+	"socialmedia/services/imaging"
+	"socialmedia/services/storage"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ProfileResponse represents the response structure for the GetProfile function.
 type ProfileResponse struct {
-	ID             uint      `json:"id"`
-	Email          string    `json:"email"`
-	Name           string    `json:"name"`
-	Username       string    `json:"username"`
-	ProfilePicture string    `json:"profile_picture"`
-	Bio            string    `json:"bio"`
-	CreatedAt      time.Time `json:"created_at"`
-	FollowersCount int       `json:"followers_count"`
-	FollowingCount int       `json:"following_count"`
+	ID               uint      `json:"id"`
+	Email            string    `json:"email"`
+	EmailVerified    bool      `json:"email_verified"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	Name             string    `json:"name"`
+	Username         string    `json:"username"`
+	ProfilePicture   string    `json:"profile_picture"`
+	Bio              string    `json:"bio"`
+	Role             string    `json:"role"`
+	IsPrivate        bool      `json:"is_private"`
+	CreatedAt        time.Time `json:"created_at"`
+	FollowersCount   int       `json:"followers_count"`
+	FollowingCount   int       `json:"following_count"`
+	// Bytes of media stored, and the most that can be (0 for no limit).
+	StorageUsed  int64 `json:"storage_used"`
+	StorageQuota int64 `json:"storage_quota"`
+	// When the account will be purged, if its deletion has been requested.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
 }
 
 // GetProfile returns the profile of the authenticated user.
@@ -35,69 +56,628 @@ func GetProfile(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
 	var user models.User
-	if err := models.DB.Preload("Followers").Preload("Following").First(&user, userID).Error; err != nil {
+	if err := models.DB.First(&user, userID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "User not found"})
 	}
+	return c.JSON(newProfileResponse(user))
+}
+
+// Profile field limits.
+const (
+	maxNameLength = 50
+	maxBioLength  = 160
+
+	// Avatars are cropped to a square of this many pixels.
+	avatarSize     = 400
+	maxAvatarBytes = 4 << 20
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// UpdateProfileInput holds the profile fields to change; omitted fields are
+// left as they are.
+type UpdateProfileInput struct {
+	Name      *string `json:"name"`
+	Username  *string `json:"username"`
+	Bio       *string `json:"bio"`
+	IsPrivate *bool   `json:"is_private"`
+}
 
-	// Build profile response.
-	profile := ProfileResponse{
+func newProfileResponse(user models.User) ProfileResponse {
+	return ProfileResponse{
+		ID:                  user.ID,
+		Email:               user.Email,
+		EmailVerified:       user.EmailVerifiedAt != nil,
+		TwoFactorEnabled:    user.TwoFactorEnabled,
+		Name:                user.Name,
+		Username:            user.Username,
+		ProfilePicture:      user.ProfilePicture,
+		Bio:                 user.Bio,
+		Role:                user.Role,
+		IsPrivate:           user.IsPrivate,
+		CreatedAt:           user.CreatedAt,
+		FollowersCount:      int(user.FollowerCount),
+		FollowingCount:      int(user.FollowingCount),
+		StorageUsed:         user.StorageUsed,
+		StorageQuota:        config.UserStorageQuota,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+}
+
+// UpdateProfile changes the authenticated user's name, username or bio.
+// @Summary Update user profile
+// @Description Update the name, username, bio or privacy of the authenticated user. Making a private account public approves all pending follow requests. Usernames are 3-30 lowercase letters, digits or underscores; a previous username stays reserved for you and still resolves to your profile.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param updateProfileInput body UpdateProfileInput true "Fields to change"
+// @Success 200 {object} ProfileResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /profile [patch]
+// @Security ApiKeyAuth
+func UpdateProfile(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var input UpdateProfileInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request payload"})
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: fmt.Sprintf("Name must be between 1 and %d characters", maxNameLength)})
+		}
+		updates["name"] = name
+	}
+	if input.Bio != nil {
+		bio := strings.TrimSpace(*input.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: fmt.Sprintf("Bio must be at most %d characters", maxBioLength)})
+		}
+		updates["bio"] = bio
+	}
+	// Going public lets everyone who asked to follow in.
+	approvePending := false
+	if input.IsPrivate != nil && *input.IsPrivate != user.IsPrivate {
+		updates["is_private"] = *input.IsPrivate
+		approvePending = !*input.IsPrivate
+	}
+
+	oldUsername := user.Username
+	newUsername := ""
+	if input.Username != nil {
+		newUsername = strings.ToLower(strings.TrimSpace(*input.Username))
+		if !usernamePattern.MatchString(newUsername) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Username must be 3-30 lowercase letters, digits or underscores"})
+		}
+		if newUsername == oldUsername {
+			newUsername = ""
+		}
+	}
+
+	if newUsername != "" {
+		taken, err := models.UsernameTaken(models.DB, newUsername, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update profile"})
+		}
+		if taken {
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Username is already taken"})
+		}
+		updates["username"] = newUsername
+	}
+
+	if len(updates) == 0 {
+		return c.JSON(newProfileResponse(user))
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if approvePending {
+			var requests []models.FollowRequest
+			if err := tx.Where("target_id = ?", user.ID).Find(&requests).Error; err != nil {
+				return err
+			}
+			for _, request := range requests {
+				if err := approveFollowRequest(tx, request); err != nil {
+					return err
+				}
+			}
+			// Counters changed underneath the copy we respond with.
+			if len(requests) > 0 {
+				if err := tx.First(&user, user.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if newUsername == "" {
+			return nil
+		}
+		// Keep the old name resolving to this user. Taking back one of your
+		// own previous names makes it current again.
+		if err := tx.Where("user_id = ? AND LOWER(username) = ?", user.ID, newUsername).Delete(&models.UsernameHistory{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UsernameHistory{UserID: user.ID, Username: oldUsername}).Error
+	})
+	if err != nil {
+		// The unique index on username catches a concurrent change that
+		// claimed the same name.
+		if newUsername != "" {
+			if taken, _ := models.UsernameTaken(models.DB, newUsername, user.ID); taken {
+				return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Username is already taken"})
+			}
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update profile"})
+	}
+
+	return c.JSON(newProfileResponse(user))
+}
+
+// UploadAvatar replaces the authenticated user's profile picture.
+// @Summary Upload profile picture
+// @Description Upload a JPEG, PNG, GIF or WebP image as the profile picture. The image is cropped to a centred square and resized to 400x400. The previous uploaded picture is deleted.
+// @Tags User
+// @Accept multipart/form-data
+// @Produce json
+// @Param avatar formData file true "Image file"
+// @Success 200 {object} ProfileResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /profile/avatar [post]
+// @Security ApiKeyAuth
+func UploadAvatar(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "An avatar file is required"})
+	}
+	if file.Size > maxAvatarBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(ErrorResponse{Error: "Avatar must be at most 4 MB"})
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Could not read avatar"})
+	}
+	defer src.Close()
+
+	data, _, err := imaging.Square(src, avatarSize)
+	if err != nil {
+		if errors.Is(err, imaging.ErrUnsupportedFormat) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Avatar must be a JPEG, PNG, GIF or WebP image"})
+		}
+		if errors.Is(err, imaging.ErrTooLarge) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Avatar dimensions are too large"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to process avatar"})
+	}
+
+	obj, _, err := storage.Upload(c.UserContext(), "avatars", bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		log.Printf("Failed to upload avatar for user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to upload avatar"})
+	}
+
+	// Read the current avatar inside the transaction: the user loaded for
+	// the request may be stale if another upload finished in between.
+	var previous string
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.User
+		if err := tx.Select("avatar_key").First(&current, user.ID).Error; err != nil {
+			return err
+		}
+		previous = current.AvatarKey
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).
+			Updates(map[string]interface{}{"profile_picture": obj.URL, "avatar_key": obj.Key}).Error
+	})
+	if err != nil {
+		storage.DeleteAll(c.UserContext(), []string{obj.Key})
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update profile"})
+	}
+	if previous != "" {
+		storage.DeleteAll(c.UserContext(), []string{previous})
+	}
+
+	user.ProfilePicture, user.AvatarKey = obj.URL, obj.Key
+	return c.JSON(newProfileResponse(user))
+}
+
+// PublicProfileResponse is the part of a profile other users can see.
+type PublicProfileResponse struct {
+	ID             uint      `json:"id"`
+	Name           string    `json:"name"`
+	Username       string    `json:"username"`
+	ProfilePicture string    `json:"profile_picture"`
+	Bio            string    `json:"bio"`
+	CreatedAt      time.Time `json:"created_at"`
+	FollowersCount int64     `json:"followers_count"`
+	FollowingCount int64     `json:"following_count"`
+	IsFollowing    bool      `json:"is_following"` // the caller follows this user
+	FollowsYou     bool      `json:"follows_you"`  // this user follows the caller
+	Blocking       bool      `json:"blocking"`     // the caller has blocked this user
+	Muting         bool      `json:"muting"`       // the caller has muted this user
+	IsPrivate      bool      `json:"is_private"`
+	Requested      bool      `json:"requested"` // the caller has asked to follow this private user
+}
+
+// UserSummaryResponse is one entry in a list of users.
+type UserSummaryResponse struct {
+	ID             uint   `json:"id"`
+	Name           string `json:"name"`
+	Username       string `json:"username"`
+	ProfilePicture string `json:"profile_picture"`
+	Bio            string `json:"bio"`
+	IsFollowing    bool   `json:"is_following"`
+	FollowsYou     bool   `json:"follows_you"`
+}
+
+// UserListResponse is a page of users.
+type UserListResponse struct {
+	Users    []UserSummaryResponse `json:"users"`
+	Metadata PaginationMetadata    `json:"metadata"`
+}
+
+// followRelations reports, for each of userIDs, whether viewerID follows
+// them and whether they follow viewerID.
+func followRelations(viewerID uint, userIDs []uint) (following, followers map[uint]bool, err error) {
+	following = map[uint]bool{}
+	followers = map[uint]bool{}
+	if len(userIDs) == 0 {
+		return following, followers, nil
+	}
+
+	var follows []models.Follow
+	if err := models.DB.
+		Where("(follower_id = ? AND following_id IN ?) OR (following_id = ? AND follower_id IN ?)", viewerID, userIDs, viewerID, userIDs).
+		Find(&follows).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, f := range follows {
+		if f.FollowerID == viewerID {
+			following[f.FollowingID] = true
+		}
+		if f.FollowingID == viewerID {
+			followers[f.FollowerID] = true
+		}
+	}
+	return following, followers, nil
+}
+
+// findVisibleUser loads the user named by the :id parameter, responding with
+// an error and returning false if there is no such user or they are hidden.
+func findVisibleUser(c *fiber.Ctx) (*models.User, bool) {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := models.DB.Scopes(models.VisibleUsers).First(&user, userID).Error; err != nil {
+		c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// GetUserByUsername returns another user's public profile.
+// @Summary Get a user's profile
+// @Description Get a user's public profile by username. Usernames the user had before still resolve to them.
+// @Tags User
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} PublicProfileResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/{username} [get]
+// @Security ApiKeyAuth
+func GetUserByUsername(c *fiber.Ctx) error {
+	viewerID := c.Locals("user_id").(uint)
+
+	user, err := models.FindUserByUsername(models.DB, c.Params("username"))
+	if err != nil || !user.IsVisible() {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "User not found"})
+	}
+
+	// Someone who has blocked the caller is invisible to them.
+	blockedBy, err := models.HasBlocked(models.DB, user.ID, viewerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch user"})
+	}
+	if blockedBy {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "User not found"})
+	}
+	blocking, err := models.HasBlocked(models.DB, viewerID, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch user"})
+	}
+	var mutes, requests int64
+	if err := models.DB.Model(&models.Mute{}).Where("muter_id = ? AND muted_id = ?", viewerID, user.ID).Count(&mutes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch user"})
+	}
+	if err := models.DB.Model(&models.FollowRequest{}).Where("requester_id = ? AND target_id = ?", viewerID, user.ID).Count(&requests).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch user"})
+	}
+
+	following, followers, err := followRelations(viewerID, []uint{user.ID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch user"})
+	}
+
+	return c.JSON(PublicProfileResponse{
 		ID:             user.ID,
-		Email:          user.Email,
 		Name:           user.Name,
 		Username:       user.Username,
 		ProfilePicture: user.ProfilePicture,
 		Bio:            user.Bio,
 		CreatedAt:      user.CreatedAt,
-		FollowersCount: len(user.Followers),
-		FollowingCount: len(user.Following),
+		FollowersCount: user.FollowerCount,
+		FollowingCount: user.FollowingCount,
+		IsFollowing:    following[user.ID],
+		FollowsYou:     followers[user.ID],
+		Blocking:       blocking,
+		Muting:         mutes > 0,
+		IsPrivate:      user.IsPrivate,
+		Requested:      requests > 0,
+	})
+}
+
+// GetUserPosts returns a user's posts, newest first.
+// @Summary List a user's posts
+// @Description Get a page of the posts written by a user. Private users' posts are only shown to their followers.
+// @Tags User
+// @Produce json
+// @Param id path int true "User ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Posts per page (default: 10, max 100)"
+// @Success 200 {object} PostListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/{id}/posts [get]
+// @Security ApiKeyAuth
+func GetUserPosts(c *fiber.Ctx) error {
+	viewerID := c.Locals("user_id").(uint)
+	user, ok := findVisibleUser(c)
+	if !ok {
+		return nil
+	}
+	blockedBy, err := models.HasBlocked(models.DB, user.ID, viewerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch posts"})
+	}
+	if blockedBy {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "User not found"})
+	}
+	if !checkCanSeeContent(c, viewerID, user.ID) {
+		return nil
+	}
+	page, limit := pageParams(c, 10)
+
+	query := models.DB.Model(&models.Post{}).Where("user_id = ?", user.ID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to count posts"})
+	}
+
+	var posts []models.Post
+	if err := query.Preload("User").Scopes(models.PreloadMedia).
+		Order("created_at desc").Limit(limit).Offset((page - 1) * limit).
+		Find(&posts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch posts"})
+	}
+
+	// Mark the posts the caller has liked.
+	postIDs := make([]uint, len(posts))
+	for i, p := range posts {
+		postIDs[i] = p.ID
+	}
+	var liked []uint
+	if len(postIDs) > 0 {
+		if err := models.DB.Model(&models.Like{}).
+			Where("user_id = ? AND post_id IN ?", viewerID, postIDs).
+			Pluck("post_id", &liked).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch posts"})
+		}
+	}
+	likedSet := make(map[uint]bool, len(liked))
+	for _, id := range liked {
+		likedSet[id] = true
+	}
+	for i := range posts {
+		posts[i].ILiked = likedSet[posts[i].ID]
+	}
+
+	return c.JSON(PostListResponse{
+		Posts:    posts,
+		Metadata: newPaginationMetadata(total, page, limit),
+	})
+}
+
+// GetFollowers lists the users who follow a user.
+// @Summary List followers
+// @Description Get a page of a user's followers, most recent first, with whether you follow each of them and whether they follow you
+// @Tags User
+// @Produce json
+// @Param id path int true "User ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Users per page (default: 20, max 100)"
+// @Success 200 {object} UserListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/{id}/followers [get]
+// @Security ApiKeyAuth
+func GetFollowers(c *fiber.Ctx) error {
+	return listFollows(c, "follows.following_id", "follows.follower_id")
+}
+
+// GetFollowing lists the users a user follows.
+// @Summary List followed users
+// @Description Get a page of the users a user follows, most recent first, with whether you follow each of them and whether they follow you
+// @Tags User
+// @Produce json
+// @Param id path int true "User ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Users per page (default: 20, max 100)"
+// @Success 200 {object} UserListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/users/{id}/following [get]
+// @Security ApiKeyAuth
+func GetFollowing(c *fiber.Ctx) error {
+	return listFollows(c, "follows.follower_id", "follows.following_id")
+}
+
+// listFollows responds with a page of the users on the other side of the
+// target user's follows: matchColumn selects the target's side of the
+// relationship and userColumn the side to list.
+func listFollows(c *fiber.Ctx, matchColumn, userColumn string) error {
+	viewerID := c.Locals("user_id").(uint)
+	user, ok := findVisibleUser(c)
+	if !ok {
+		return nil
+	}
+	if !checkCanSeeContent(c, viewerID, user.ID) {
+		return nil
+	}
+	page, limit := pageParams(c, 20)
+
+	query := models.DB.Model(&models.User{}).Scopes(models.VisibleUsers).
+		Joins("JOIN follows ON "+userColumn+" = users.id AND follows.deleted_at IS NULL").
+		Where(matchColumn+" = ?", user.ID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to count users"})
+	}
+
+	var users []models.User
+	if err := query.Select("users.*").Order("follows.created_at desc").
+		Limit(limit).Offset((page - 1) * limit).
+		Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch users"})
+	}
+
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	following, followers, err := followRelations(viewerID, ids)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch users"})
+	}
+
+	response := make([]UserSummaryResponse, len(users))
+	for i, u := range users {
+		response[i] = UserSummaryResponse{
+			ID:             u.ID,
+			Name:           u.Name,
+			Username:       u.Username,
+			ProfilePicture: u.ProfilePicture,
+			Bio:            u.Bio,
+			IsFollowing:    following[u.ID],
+			FollowsYou:     followers[u.ID],
+		}
 	}
-	return c.JSON(profile)
+	return c.JSON(UserListResponse{
+		Users:    response,
+		Metadata: newPaginationMetadata(total, page, limit),
+	})
 }
 
 // FollowUser lets the current user follow another user.
 // @Summary Follow a user
-// @Description Follow another user by their ID
+// @Description Follow another user by their ID. Following a private account sends a follow request instead and returns 202.
 // @Tags User
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
 // @Success 200 {object} MessageResponse
+// @Success 202 {object} MessageResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /users/{id}/follow [post]
 // @Security ApiKeyAuth
 func FollowUser(c *fiber.Ctx) error {
 	currentUserID := c.Locals("user_id").(uint)
-	targetID, err := strconv.Atoi(c.Params("id"))
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID"})
+	target, ok := findVisibleUser(c)
+	if !ok {
+		return nil
 	}
 
-	if uint(targetID) == currentUserID {
+	if target.ID == currentUserID {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot follow yourself"})
 	}
-
-	// Check if already following.
-	var follow models.Follow
-	if err := models.DB.Where("follower_id = ? AND following_id = ?", currentUserID, targetID).First(&follow).Error; err == nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Already following"})
+	if !checkNotBlocked(c, currentUserID, target.ID) {
+		return nil
 	}
 
-	follow = models.Follow{
-		FollowerID:  currentUserID,
-		FollowingID: uint(targetID),
+	// Private accounts have to approve new followers.
+	if target.IsPrivate {
+		return requestFollow(c, currentUserID, target.ID)
 	}
 
-	if err := models.DB.Create(&follow).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: err.Error()})
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		// The unique index on the pair makes a concurrent duplicate a no-op.
+		follow := models.Follow{FollowerID: currentUserID, FollowingID: target.ID}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyFollowing
+		}
+		return adjustFollowCounts(tx, currentUserID, target.ID, 1)
+	})
+	if errors.Is(err, errAlreadyFollowing) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Already following"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to follow user"})
 	}
 
 	return c.JSON(MessageResponse{Message: "User followed"})
 }
 
+// requestFollow asks a private user to approve the caller as a follower.
+func requestFollow(c *fiber.Ctx, currentUserID, targetID uint) error {
+	var following int64
+	if err := models.DB.Model(&models.Follow{}).
+		Where("follower_id = ? AND following_id = ?", currentUserID, targetID).
+		Count(&following).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to follow user"})
+	}
+	if following > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Already following"})
+	}
+
+	request := models.FollowRequest{RequesterID: currentUserID, TargetID: targetID}
+	result := models.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&request)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to follow user"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Follow request already sent"})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(MessageResponse{Message: "Follow request sent"})
+}
+
 // UnfollowUser lets the current user unfollow another user.
 // @Summary Unfollow a user
-// @Description Unfollow another user by their ID
+// @Description Unfollow another user by their ID, or withdraw a pending follow request
 // @Tags User
 // @Accept json
 // @Produce json
@@ -114,14 +694,48 @@ func UnfollowUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID"})
 	}
 
-	var follow models.Follow
-	if err := models.DB.Where("follower_id = ? AND following_id = ?", currentUserID, targetID).First(&follow).Error; err != nil {
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().
+			Where("follower_id = ? AND following_id = ?", currentUserID, targetID).
+			Delete(&models.Follow{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNotFollowing
+		}
+		return adjustFollowCounts(tx, currentUserID, uint(targetID), -1)
+	})
+	if errors.Is(err, errNotFollowing) {
+		// Unfollowing a private user before they answer withdraws the request.
+		result := models.DB.Where("requester_id = ? AND target_id = ?", currentUserID, targetID).Delete(&models.FollowRequest{})
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to unfollow user"})
+		}
+		if result.RowsAffected > 0 {
+			return c.JSON(MessageResponse{Message: "Follow request cancelled"})
+		}
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Not following"})
 	}
-
-	if err := models.DB.Delete(&follow).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: err.Error()})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to unfollow user"})
 	}
 
 	return c.JSON(MessageResponse{Message: "User unfollowed"})
 }
+
+var (
+	errAlreadyFollowing = errors.New("already following")
+	errNotFollowing     = errors.New("not following")
+)
+
+// adjustFollowCounts moves the following counter of followerID and the
+// follower counter of followingID by delta, never below zero.
+func adjustFollowCounts(tx *gorm.DB, followerID, followingID uint, delta int) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", followerID).
+		UpdateColumn("following_count", gorm.Expr("CASE WHEN following_count + ? > 0 THEN following_count + ? ELSE 0 END", delta, delta)).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", followingID).
+		UpdateColumn("follower_count", gorm.Expr("CASE WHEN follower_count + ? > 0 THEN follower_count + ? ELSE 0 END", delta, delta)).Error
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"socialmedia/internal/testutil"
+	"socialmedia/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGetProfileReportsAccountState(t *testing.T) {
+	setupTestDB(t)
+	deletion := time.Now().Add(time.Hour)
+	user := createTestUser(t, "alice@example.com", func(u *models.User) {
+		u.TwoFactorEnabled = true
+		u.DeletionScheduledAt = &deletion
+	})
+
+	resp := getAs(t, GetProfile, "/api/profile", "/api/profile", user)
+	var profile ProfileResponse
+	decodeJSON(t, resp, &profile)
+	if !profile.TwoFactorEnabled {
+		t.Errorf("profile = %+v, want two-factor authentication enabled", profile)
+	}
+	if profile.DeletionScheduledAt == nil || !profile.DeletionScheduledAt.Equal(deletion) {
+		t.Errorf("deletion scheduled at = %v, want %v", profile.DeletionScheduledAt, deletion)
+	}
+}
+
+// uploadAvatar sends data as user's new avatar.
+func uploadAvatar(t *testing.T, user models.User, data []byte) ProfileResponse {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	w.Close()
+
+	app := fiber.New()
+	app.Post("/api/profile/avatar", asUser(user), UploadAvatar)
+	req := httptest.NewRequest(http.MethodPost, "/api/profile/avatar", &body)
+	req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("UploadAvatar status = %d", resp.StatusCode)
+	}
+	var profile ProfileResponse
+	decodeJSON(t, resp, &profile)
+	return profile
+}
+
+func TestUploadAvatarReplacesPrevious(t *testing.T) {
+	setupTestDB(t)
+	dir := testutil.UseStorage(t).Dir
+	user := createTestUser(t, "alice@example.com")
+	data := testPNG(t)
+
+	first := uploadAvatar(t, user, data)
+	second := uploadAvatar(t, user, data)
+	if second.ProfilePicture == "" || second.ProfilePicture == first.ProfilePicture {
+		t.Fatalf("profile pictures = %q then %q", first.ProfilePicture, second.ProfilePicture)
+	}
+
+	// Only the new avatar is left.
+	if got := countFiles(t, dir); got != 1 {
+		t.Errorf("files = %d, want 1", got)
+	}
+	if err := models.DB.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.ProfilePicture != second.ProfilePicture || !strings.HasSuffix(user.ProfilePicture, user.AvatarKey) {
+		t.Errorf("user = %q (key %q), want %q", user.ProfilePicture, user.AvatarKey, second.ProfilePicture)
+	}
+}
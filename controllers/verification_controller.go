@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"fmt"
+	"socialmedia/config"
+	"socialmedia/mailer"
+	"socialmedia/models"
+	"socialmedia/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// sendVerificationEmail issues a new verification token for the user,
+// invalidating any earlier ones, and emails the verification link.
+func sendVerificationEmail(user models.User) error {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.EmailVerification{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailVerification{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(config.EmailVerificationTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.AppURL, token)
+	mailer.SendAsync(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s",
+			user.Name, config.EmailVerificationTTL, link),
+	})
+	return nil
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Confirm ownership of an email address using the token from the verification email
+// @Tags Auth
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} AuthResponse
+// @Failure 500 {object} AuthResponse
+// @Router /api/verify-email [get]
+func VerifyEmail(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Verification token is required",
+		})
+	}
+
+	invalid := func() error {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Invalid or expired verification token",
+		})
+	}
+
+	var verification models.EmailVerification
+	if err := models.DB.Where("token_hash = ?", utils.HashToken(token)).First(&verification).Error; err != nil {
+		return invalid()
+	}
+	now := time.Now()
+	if verification.UsedAt != nil || now.After(verification.ExpiresAt) {
+		return invalid()
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.EmailVerification{}).
+			Where("id = ? AND used_at IS NULL", verification.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTokenUsed
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", verification.UserID).
+			Update("email_verified_at", now).Error
+	})
+	if err == errTokenUsed {
+		return invalid()
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not verify email",
+		})
+	}
+
+	return c.JSON(AuthResponse{
+		Status:  "success",
+		Message: "Email verified",
+	})
+}
+
+// ResendVerificationEmail godoc
+// @Summary Resend the verification email
+// @Description Send a new verification link to the authenticated user's email address
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} AuthResponse
+// @Failure 500 {object} AuthResponse
+// @Router /api/verify-email/resend [post]
+// @Security ApiKeyAuth
+func ResendVerificationEmail(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if user.EmailVerifiedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Email is already verified",
+		})
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(AuthResponse{
+			Status:  "error",
+			Message: "Could not send verification email",
+		})
+	}
+
+	return c.JSON(AuthResponse{
+		Status:  "success",
+		Message: "Verification email sent",
+	})
+}
@@ -0,0 +1,46 @@
+// Package testutil sets up the database and media storage that tests run
+// against.
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+
+	"socialmedia/models"
+	"socialmedia/services/storage"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// NewDB opens a fresh, migrated SQLite database that is closed when the
+// test ends.
+func NewDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	models.Migrate(db)
+	if err := models.SetupUserSearch(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// UseStorage stores media in a temporary directory until the test ends,
+// and returns the backend doing so.
+func UseStorage(t testing.TB) *storage.Local {
+	t.Helper()
+	prev := storage.Current()
+	backend := storage.NewLocal(t.TempDir(), "/media")
+	storage.SetBackend(backend)
+	t.Cleanup(func() { storage.SetBackend(prev) })
+	return backend
+}
@@ -0,0 +1,226 @@
+// Package keyring signs and verifies the JWTs this service issues. Tokens are
+// signed with one asymmetric key and carry its ID in the "kid" header; any
+// key in the ring can verify, so old keys can stay around while tokens
+// signed with them expire.
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+
+	"socialmedia/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Key is a signing or verification key.
+type Key struct {
+	ID        string
+	Algorithm string // "RS256" or "EdDSA"
+	private   crypto.Signer
+	public    crypto.PublicKey
+}
+
+// CanSign reports whether the key has a private half.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// Keyring holds the current signing key and every key accepted for
+// verification.
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// New builds a keyring that signs with signing and also accepts tokens
+// signed by any of the verification keys.
+func New(signing *Key, verification ...*Key) (*Keyring, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, errors.New("keyring: signing key must include a private key")
+	}
+	ring := &Keyring{signing: signing, keys: map[string]*Key{signing.ID: signing}}
+	for _, k := range verification {
+		if _, ok := ring.keys[k.ID]; ok {
+			return nil, fmt.Errorf("keyring: duplicate key ID %q", k.ID)
+		}
+		ring.keys[k.ID] = k
+	}
+	return ring, nil
+}
+
+// Sign signs claims with the current signing key.
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(r.signing.Algorithm), claims)
+	token.Header["kid"] = r.signing.ID
+	return token.SignedString(r.signing.private)
+}
+
+// Parse verifies a token against the key named by its "kid" header and
+// decodes it into claims.
+func (r *Keyring) Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+	return parser.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := r.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("key %q does not use %s", kid, token.Method.Alg())
+		}
+		return key.public, nil
+	})
+}
+
+// Audiences of the tokens this service signs. Every token names the one
+// place it may be used, so a 2FA challenge or a magic link cannot stand in
+// for an access token.
+const (
+	AudienceAccess    = "access"
+	AudienceChallenge = "2fa_challenge"
+	AudienceMagicLink = "magic_link"
+)
+
+// Issuer is the "iss" claim of the tokens this service signs.
+func Issuer() string {
+	return config.APIURL
+}
+
+// audienceClaims is implemented by jwt.MapClaims and *jwt.RegisteredClaims.
+type audienceClaims interface {
+	VerifyIssuer(cmp string, required bool) bool
+	VerifyAudience(cmp string, required bool) bool
+}
+
+// ParseFor verifies a token like Parse and also requires that this service
+// issued it for audience.
+func (r *Keyring) ParseFor(tokenStr string, claims jwt.Claims, audience string) (*jwt.Token, error) {
+	token, err := r.Parse(tokenStr, claims)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := claims.(audienceClaims)
+	if !ok || !c.VerifyIssuer(Issuer(), true) || !c.VerifyAudience(audience, true) {
+		return nil, fmt.Errorf("token was not issued for %s", audience)
+	}
+	return token, nil
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of every key in the ring.
+func (r *Keyring) JWKS() JWKSet {
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKSet{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		key := r.keys[id]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+var (
+	ring  *Keyring
+	mutex sync.RWMutex
+)
+
+// Set replaces the keyring used by Sign, Parse and JWKS.
+func Set(r *Keyring) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	ring = r
+}
+
+// Configure loads the keyring from config.JWTKeysDir. In development, when
+// no directory is configured, a throwaway key is generated instead so the
+// server can start without any setup; tokens then stop working on restart.
+func Configure() error {
+	if config.JWTKeysDir == "" {
+		if !config.IsDevelopment() {
+			return errors.New("JWT_KEYS_DIR must be set outside development (APP_ENV=development)")
+		}
+		r, err := Generate()
+		if err != nil {
+			return err
+		}
+		log.Println("JWT_KEYS_DIR not set, signing tokens with a temporary key")
+		Set(r)
+		return nil
+	}
+
+	r, err := LoadDir(config.JWTKeysDir, config.JWTSigningKeyID)
+	if err != nil {
+		return err
+	}
+	Set(r)
+	return nil
+}
+
+func current() *Keyring {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if ring == nil {
+		panic("keyring: not configured")
+	}
+	return ring
+}
+
+// Sign signs claims with the configured keyring.
+func Sign(claims jwt.Claims) (string, error) {
+	return current().Sign(claims)
+}
+
+// Parse verifies a token with the configured keyring.
+func Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	return current().Parse(tokenStr, claims)
+}
+
+// ParseFor verifies a token for audience with the configured keyring.
+func ParseFor(tokenStr string, claims jwt.Claims, audience string) (*jwt.Token, error) {
+	return current().ParseFor(tokenStr, claims, audience)
+}
+
+// JWKS returns the configured keyring's public keys.
+func JWKS() JWKSet {
+	return current().JWKS()
+}
@@ -0,0 +1,138 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadDir loads every "<kid>.pem" file in dir. Files holding a private key
+// (PKCS#8, or PKCS#1 for RSA) can sign; files holding only a public key
+// (PKIX) are accepted for verification, e.g. a retired key whose tokens have
+// not expired yet. signingID picks the signing key and may be empty when the
+// directory contains exactly one private key.
+func LoadDir(dir, signingID string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("keyring: no .pem files in %s", dir)
+	}
+
+	var keys []*Key
+	var private []*Key
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParsePEM(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: %s: %w", path, err)
+		}
+		keys = append(keys, key)
+		if key.CanSign() {
+			private = append(private, key)
+		}
+	}
+
+	var signing *Key
+	switch {
+	case signingID != "":
+		for _, k := range private {
+			if k.ID == signingID {
+				signing = k
+			}
+		}
+		if signing == nil {
+			return nil, fmt.Errorf("keyring: no private key %q in %s", signingID, dir)
+		}
+	case len(private) == 1:
+		signing = private[0]
+	default:
+		return nil, fmt.Errorf("keyring: %d private keys in %s, set JWT_SIGNING_KEY_ID to choose one", len(private), dir)
+	}
+
+	var verification []*Key
+	for _, k := range keys {
+		if k != signing {
+			verification = append(verification, k)
+		}
+	}
+	return New(signing, verification...)
+}
+
+// ParsePEM decodes a PEM-encoded RSA or Ed25519 key.
+func ParsePEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		return newKey(id, signer, signer.Public())
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(id, parsed, parsed.Public())
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(id, nil, parsed)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func newKey(id string, private crypto.Signer, public crypto.PublicKey) (*Key, error) {
+	key := &Key{ID: id, private: private, public: public}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key.Algorithm = "RS256"
+	case ed25519.PublicKey:
+		key.Algorithm = "EdDSA"
+	default:
+		return nil, fmt.Errorf("unsupported key type %T; use RSA or Ed25519", public)
+	}
+	return key, nil
+}
+
+// Generate returns a keyring with a fresh Ed25519 key that only lives as long
+// as the process.
+func Generate() (*Keyring, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := newKey(fmt.Sprintf("dev-%x", public[:4]), private, public)
+	if err != nil {
+		return nil, err
+	}
+	return New(key)
+}
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes messages to a file (or stderr) instead of delivering them.
+// It is meant for local development and tests.
+type LogMailer struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+// NewLogMailer appends messages to the file at path, or to stderr when path is empty.
+func NewLogMailer(path string) (*LogMailer, error) {
+	if path == "" {
+		return &LogMailer{w: os.Stderr}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &LogMailer{w: f}, nil
+}
+
+// NewWriterMailer writes messages to w.
+func NewWriterMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w: w}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, err := fmt.Fprintf(m.w, "=== %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"socialmedia/config"
+	"sync"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	defaultMailer Mailer
+	mutex         sync.Mutex
+)
+
+// Get returns the mailer selected by config.MailDriver, creating it on first use.
+func Get() Mailer {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if defaultMailer == nil {
+		defaultMailer = fromConfig()
+	}
+	return defaultMailer
+}
+
+// Set overrides the mailer returned by Get.
+func Set(m Mailer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	defaultMailer = m
+}
+
+func fromConfig() Mailer {
+	switch config.MailDriver {
+	case "smtp":
+		return NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	case "log", "":
+		m, err := NewLogMailer(config.MailLogPath)
+		if err != nil {
+			log.Printf("Could not open mail log %q, logging to stderr: %v", config.MailLogPath, err)
+			m, _ = NewLogMailer("")
+		}
+		return m
+	default:
+		log.Printf("Unknown MAIL_DRIVER %q, logging emails instead", config.MailDriver)
+		m, _ := NewLogMailer("")
+		return m
+	}
+}
+
+// SendAsync delivers a message in the background, logging any failure. It is
+// used by request handlers whose response must not depend on mail delivery.
+func SendAsync(msg Message) {
+	go func() {
+		if err := Get().Send(context.Background(), msg); err != nil {
+			log.Printf("Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
+	"socialmedia/blacklist"
 	"socialmedia/config"
 	_ "socialmedia/docs"
+	"socialmedia/keyring"
 	"socialmedia/models"
 	"socialmedia/routes"
+	"socialmedia/services/account"
+	"socialmedia/services/storage"
+	"socialmedia/services/suggestions"
+	"socialmedia/services/uploads"
 
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 
@@ -17,15 +24,48 @@ func main() {
 	// Initialize configuration (loads .env if present)
 	config.InitConfig()
 
+	// Load the keys that sign access tokens.
+	if err := keyring.Configure(); err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+
+	// Select where uploaded media is stored.
+	if err := storage.Configure(); err != nil {
+		log.Fatal("Failed to configure media storage: ", err)
+	}
+
 	// Connect to the database and run migrations
 	db := models.ConnectDatabase()
 	models.Migrate(db)
+	if err := models.SetupUserSearch(db); err != nil {
+		log.Fatal("Failed to set up user search: ", err)
+	}
+	models.PromoteAdmins(db, config.AdminEmails)
+
+	// Select the token blacklist backend and start purging expired entries.
+	blacklist.Configure(db)
+	blacklist.StartSweeper(context.Background(), config.BlacklistSweepInterval)
+
+	// Permanently delete accounts whose deletion grace period has ended.
+	account.StartPurger(context.Background(), db, config.AccountPurgeInterval)
+
+	// Keep follow suggestions fresh for users who are still around.
+	suggestions.StartRefresher(context.Background(), db, config.SuggestionsTTL, config.SuggestionsRefreshInterval)
+
+	// Clean up direct uploads that were never completed and media never
+	// attached to a post.
+	uploads.StartSweeper(context.Background(), db, config.UploadSweepInterval, config.PendingMediaTTL)
 
 	// Initialize the Fiber app
-	app := fiber.New()
+	// Request bodies are limited per route: only the upload routes may
+	// exceed RequestBodyLimit.
+	app := fiber.New(fiber.Config{
+		BodyLimit: config.RequestBodyLimit,
+	})
+	app.Server().HeaderReceived = routes.BodyLimit
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:3000,https://tours-dashboard-pi.vercel.app", // or your Next.js URL
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
 		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
 		AllowCredentials: true,
 	}))
@@ -2,14 +2,19 @@ package middlewares
 
 import (
 	"socialmedia/blacklist"
-	"socialmedia/config"
+	"socialmedia/keyring"
 	"socialmedia/models"
+	"socialmedia/utils"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// JWTMiddleware authenticates requests bearing either a session access token
+// (JWT) or a personal access token. Personal access tokens are limited to
+// their scopes, which RequireScope enforces.
 func JWTMiddleware(c *fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
@@ -22,13 +27,14 @@ func JWTMiddleware(c *fiber.Ctx) error {
 	}
 	tokenStr := authHeader[7:]
 
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		// Ensure token signing method is HMAC.
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fiber.ErrUnauthorized
-		}
-		return []byte(config.JWTSecret), nil
-	})
+	if strings.HasPrefix(tokenStr, models.PersonalAccessTokenPrefix) {
+		return personalAccessToken(c, tokenStr)
+	}
+
+	// The keyring only accepts our asymmetric algorithms and known key IDs,
+	// and only tokens we issued as access tokens.
+	claims := jwt.MapClaims{}
+	token, err := keyring.ParseFor(tokenStr, claims, keyring.AudienceAccess)
 	if err != nil || !token.Valid {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired JWT"})
 	}
@@ -38,9 +44,9 @@ func JWTMiddleware(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token is blacklisted"})
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid JWT claims"})
+	// Reject other kinds of tokens we sign, such as 2FA login challenges.
+	if claims["typ"] != "access" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token type"})
 	}
 
 	// The user_id was set as a number (float64) during token generation.
@@ -50,10 +56,61 @@ func JWTMiddleware(c *fiber.Ctx) error {
 	}
 	c.Locals("user_id", uint(userIDFloat))
 
+	// Every access token is bound to a session; reject it once that session
+	// has been revoked (logout, device removal) or has expired.
+	sessionIDFloat, ok := claims["sid"].(float64)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid session in token"})
+	}
+	var session models.Session
+	if err := models.DB.Where("id = ? AND user_id = ?", uint(sessionIDFloat), uint(userIDFloat)).First(&session).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session not found"})
+	}
+	now := time.Now()
+	if !session.IsActive(now) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session has been revoked"})
+	}
+	// Only touch last_seen_at occasionally to avoid a write on every request.
+	if now.Sub(session.LastSeenAt) > time.Minute {
+		models.DB.Model(&session).UpdateColumn("last_seen_at", now)
+	}
+	c.Locals("session_id", session.ID)
+
 	var user models.User
 	if err := models.DB.First(&user, uint(userIDFloat)).Error; err != nil {
 		return c.Status(401).JSON(fiber.Map{"error": "User not found"})
 	}
+	if user.IsSuspended() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account suspended"})
+	}
+	c.Locals("user", user)
+	return c.Next()
+}
+
+// personalAccessToken authenticates a request made with a personal access
+// token and records the token's scopes for RequireScope.
+func personalAccessToken(c *fiber.Ctx, tokenStr string) error {
+	var pat models.PersonalAccessToken
+	if err := models.DB.Where("token_hash = ?", utils.HashToken(tokenStr)).First(&pat).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid access token"})
+	}
+	now := time.Now()
+	if !pat.IsActive(now) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Access token has expired"})
+	}
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) > time.Minute {
+		models.DB.Model(&pat).UpdateColumn("last_used_at", now)
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, pat.UserID).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.IsSuspended() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account suspended"})
+	}
+	c.Locals("user_id", user.ID)
 	c.Locals("user", user)
+	c.Locals("token_scopes", pat.ScopeList())
 	return c.Next()
 }
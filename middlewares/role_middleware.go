@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"socialmedia/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole only lets through users whose role is at least role, e.g.
+// RequireRole(models.RoleModerator) admits moderators and admins. It must run
+// after JWTMiddleware.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+		}
+		if !user.HasRole(role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient permissions"})
+		}
+		return c.Next()
+	}
+}
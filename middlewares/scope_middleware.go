@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireScope limits personal access tokens to the routes their scopes
+// cover. Reads (GET and HEAD) need "<resource>:read" or "<resource>:write";
+// anything else needs "<resource>:write". Requests authenticated with a
+// session JWT are not restricted. It must run after JWTMiddleware.
+func RequireScope(resource string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, ok := c.Locals("token_scopes").([]string)
+		if !ok {
+			return c.Next()
+		}
+
+		write := resource + ":write"
+		read := resource + ":read"
+		isRead := c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead
+		for _, scope := range scopes {
+			if scope == write || (isRead && scope == read) {
+				return c.Next()
+			}
+		}
+
+		required := write
+		if isRead {
+			required = read
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access token is missing the " + required + " scope"})
+	}
+}
+
+// RequireSession rejects personal access tokens on routes that manage the
+// account itself (credentials, sessions, two-factor settings), so a leaked
+// token cannot be used to take the account over.
+func RequireSession(c *fiber.Ctx) error {
+	if _, ok := c.Locals("token_scopes").([]string); ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This endpoint cannot be used with an access token"})
+	}
+	return c.Next()
+}
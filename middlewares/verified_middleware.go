@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"socialmedia/config"
+	"socialmedia/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireVerifiedEmail blocks users who have not verified their email address
+// when config.RequireEmailVerification is enabled. It must run after
+// JWTMiddleware.
+func RequireVerifiedEmail(c *fiber.Ctx) error {
+	if !config.RequireEmailVerification {
+		return c.Next()
+	}
+
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.EmailVerifiedAt == nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Please verify your email address first"})
+	}
+	return c.Next()
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Blob is an uploaded file, identified by the SHA-256 of its contents, so
+// uploading the same file again reuses what is already stored. Every media
+// row stored from it holds a reference, and carries a copy of the URLs and
+// keys; the stored objects are deleted with the last reference.
+type Blob struct {
+	ID        uint   `gorm:"primarykey"`
+	Hash      string `gorm:"type:varchar(64);uniqueIndex;not null"`
+	Size      int64  `gorm:"not null"` // Bytes stored, variants included
+	RefCount  int64  `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
+
+// DeleteMedia deletes the media with the given IDs along with their
+// variants, gives back the storage they were charged to their uploaders and
+// drops their references to blobs. It returns the storage keys nothing
+// refers to any more, for the caller to delete once tx commits.
+func DeleteMedia(tx *gorm.DB, ids []uint) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var media []Media
+	if err := tx.Preload("Variants").Where("id IN ?", ids).Find(&media).Error; err != nil {
+		return nil, err
+	}
+
+	var unused []string
+	for _, m := range media {
+		if m.Size > 0 {
+			if err := tx.Model(&User{}).Unscoped().Where("id = ?", m.UserID).
+				UpdateColumn("storage_used", gorm.Expr("CASE WHEN storage_used > ? THEN storage_used - ? ELSE 0 END", m.Size, m.Size)).Error; err != nil {
+				return nil, err
+			}
+		}
+		if m.BlobID != nil {
+			if err := tx.Model(&Blob{}).Where("id = ?", *m.BlobID).
+				UpdateColumn("ref_count", gorm.Expr("ref_count - 1")).Error; err != nil {
+				return nil, err
+			}
+			result := tx.Where("id = ? AND ref_count <= 0", *m.BlobID).Delete(&Blob{})
+			if result.Error != nil {
+				return nil, result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue // still in use
+			}
+		}
+		// Media from before deduplication own their objects outright.
+		if m.StorageKey != "" {
+			unused = append(unused, m.StorageKey)
+		}
+		for _, v := range m.Variants {
+			if v.StorageKey != "" {
+				unused = append(unused, v.StorageKey)
+			}
+		}
+	}
+
+	if err := tx.Where("media_id IN ?", ids).Delete(&MediaVariant{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("id IN ?", ids).Delete(&Media{}).Error; err != nil {
+		return nil, err
+	}
+	return unused, nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Block records that BlockerID has blocked BlockedID. Neither can follow the
+// other, and the blocked user can no longer see or interact with the
+// blocker's posts.
+type Block struct {
+	ID        uint `gorm:"primarykey"`
+	BlockerID uint `gorm:"not null;uniqueIndex:idx_blocks_pair"`
+	BlockedID uint `gorm:"not null;uniqueIndex:idx_blocks_pair;index"`
+	CreatedAt time.Time
+}
+
+// HasBlocked reports whether blockerID has blocked blockedID.
+func HasBlocked(db *gorm.DB, blockerID, blockedID uint) (bool, error) {
+	var count int64
+	err := db.Model(&Block{}).
+		Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsBlocked reports whether either user has blocked the other.
+func IsBlocked(db *gorm.DB, a, b uint) (bool, error) {
+	var count int64
+	err := db.Model(&Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// HideBlocked returns a query scope that drops rows whose column refers to a
+// user viewerID has blocked or been blocked by.
+func HideBlocked(viewerID uint, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Where(column+" NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?)", viewerID).
+			Where(column+" NOT IN (SELECT blocker_id FROM blocks WHERE blocked_id = ?)", viewerID)
+	}
+}
+
+// HideBlockedAndMuted returns a query scope that drops rows whose column
+// refers to a user viewerID has blocked, been blocked by or muted.
+func HideBlockedAndMuted(viewerID uint, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(HideBlocked(viewerID, column)).
+			Where(column+" NOT IN (SELECT muted_id FROM mutes WHERE muter_id = ?)", viewerID)
+	}
+}
@@ -20,6 +20,13 @@ func ConnectDatabase() *gorm.DB {
 }
 
 func Migrate(db *gorm.DB) {
+	// Follower counters were not maintained before the follows index
+	// existed, so recompute them once it is created.
+	reconcileFollows := !db.Migrator().HasIndex(&Follow{}, "idx_follows_pair")
+	if err := prepareFollowsIndex(db); err != nil {
+		log.Println("Failed to clean up follows: ", err)
+	}
+
 	db.AutoMigrate(&User{}, &Post{},
 		&Comment{},
 		&Like{},
@@ -30,5 +37,39 @@ func Migrate(db *gorm.DB) {
 		TechnologyStack{},
 		&StackItem{},
 		&Feature{},
-		&Prd{})
+		&Prd{},
+		&Session{},
+		&RevokedToken{},
+		&PasswordReset{},
+		&EmailVerification{},
+		&RecoveryCode{},
+		&OAuthIdentity{},
+		&PersonalAccessToken{},
+		&LoginAttempt{},
+		&LoginThrottle{},
+		&MagicLink{},
+		&UsernameHistory{},
+		&Block{},
+		&Mute{},
+		&FollowRequest{},
+		&Suggestion{},
+		&MediaVariant{},
+		&Blob{},
+		&Upload{})
+
+	if reconcileFollows {
+		if _, err := ReconcileFollowCounts(db); err != nil {
+			log.Println("Failed to reconcile follow counts: ", err)
+		}
+	}
+}
+
+// PromoteAdmins gives the admin role to the accounts with the given emails.
+func PromoteAdmins(db *gorm.DB, emails []string) {
+	if len(emails) == 0 {
+		return
+	}
+	if err := db.Model(&User{}).Where("email IN ?", emails).Update("role", RoleAdmin).Error; err != nil {
+		log.Println("Failed to promote admins: ", err)
+	}
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// EmailVerification is a single-use token proving ownership of a user's
+// email address. Only the SHA-256 hash of the emailed token is stored.
+type EmailVerification struct {
+	ID        uint      `gorm:"primarykey"`
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
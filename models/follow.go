@@ -4,11 +4,40 @@ import (
 	"gorm.io/gorm"
 )
 
+// Follow records that FollowerID follows FollowingID. Rows are deleted for
+// real on unfollow so the unique index on the pair allows following again.
 type Follow struct {
 	gorm.Model
-	FollowerID  uint `gorm:"primaryKey" json:"follower_id"`
-	FollowingID uint `gorm:"primaryKey" json:"following_id"`
+	FollowerID  uint `gorm:"primaryKey;uniqueIndex:idx_follows_pair" json:"follower_id"`
+	FollowingID uint `gorm:"primaryKey;uniqueIndex:idx_follows_pair" json:"following_id"`
 
 	Followers User `gorm:"foreignKey:FollowerID" json:"follower"`
 	Following User `gorm:"foreignKey:FollowingID" json:"following"`
 }
+
+// ReconcileFollowCounts recomputes every user's follower and following
+// counters from the follows table and returns how many users were corrected.
+func ReconcileFollowCounts(db *gorm.DB) (int64, error) {
+	result := db.Exec(`
+		UPDATE users SET
+			follower_count = (SELECT COUNT(*) FROM follows WHERE follows.following_id = users.id),
+			following_count = (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id)
+		WHERE follower_count <> (SELECT COUNT(*) FROM follows WHERE follows.following_id = users.id)
+			OR following_count <> (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id)`)
+	return result.RowsAffected, result.Error
+}
+
+// prepareFollowsIndex clears out soft-deleted and duplicate follows, which
+// older versions could leave behind, so the unique index can be created.
+func prepareFollowsIndex(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Follow{}) || db.Migrator().HasIndex(&Follow{}, "idx_follows_pair") {
+		return nil
+	}
+	if err := db.Exec("DELETE FROM follows WHERE deleted_at IS NOT NULL").Error; err != nil {
+		return err
+	}
+	// id is part of a composite primary key and is not always set, so tell
+	// rows apart by rowid.
+	return db.Exec(`DELETE FROM follows WHERE rowid NOT IN
+		(SELECT MIN(rowid) FROM follows GROUP BY follower_id, following_id)`).Error
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// FollowRequest is a pending request from RequesterID to follow the private
+// account TargetID. Approving it turns it into a Follow.
+type FollowRequest struct {
+	ID          uint `gorm:"primarykey"`
+	RequesterID uint `gorm:"not null;uniqueIndex:idx_follow_requests_pair"`
+	TargetID    uint `gorm:"not null;uniqueIndex:idx_follow_requests_pair;index"`
+	CreatedAt   time.Time
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// LoginAttempt is an audit record of a failed or blocked login.
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"index" json:"email"`
+	UserID    *uint     `gorm:"index" json:"user_id,omitempty"`
+	IP        string    `gorm:"index" json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
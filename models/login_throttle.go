@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginThrottle tracks recent login failures for one key, either an account
+// ("account:<email>") or a client IP ("ip:<address>").
+type LoginThrottle struct {
+	Key           string     `gorm:"primaryKey"`
+	Failures      int        `gorm:"not null;default:0"`
+	LastFailureAt time.Time  `gorm:"not null"`
+	LockedUntil   *time.Time `gorm:"index"`
+}
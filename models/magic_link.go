@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// MagicLink records an emailed passwordless login link. The link itself is a
+// signed token carrying JTI; this row makes it single-use.
+type MagicLink struct {
+	ID        uint   `gorm:"primarykey"`
+	JTI       string `gorm:"type:varchar(64);uniqueIndex;not null"`
+	Email     string `gorm:"index;not null"`
+	IP        string
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type MediaType string
@@ -15,17 +17,39 @@ const (
 // Media model
 // @Description Media represents an image or video attached to a post
 type Media struct {
-	ID        uint      `gorm:"primarykey"`
-	PostID    uint      `gorm:"index;not null"`             // Foreign key to Post table
-	UserID    uint      `gorm:"index;not null"`             // User who uploaded (might be same as Post.UserID)
-	URL       string    `gorm:"type:varchar(255);not null"` // URL of the media (e.g., S3 link)
-	Type      MediaType `gorm:"type:varchar(20);not null"`  // 'image', 'video', etc.
-	AltText   string    `gorm:"type:varchar(255)"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	// Accessibility text
+	ID uint `gorm:"primarykey" json:"id"`
+	// Post the media is attached to; nil while an upload waits to be
+	// attached to a post.
+	PostID     *uint     `gorm:"index" json:"post_id"`
+	UserID     uint      `gorm:"index;not null" json:"user_id"`         // User who uploaded (might be same as Post.UserID)
+	URL        string    `gorm:"type:varchar(255);not null" json:"url"` // URL of the media (e.g., S3 link)
+	Type       MediaType `gorm:"type:varchar(20);not null" json:"type"` // 'image', 'video', etc.
+	AltText    string    `gorm:"type:varchar(255)" json:"alt_text"`     // Accessibility text
+	Position   int       `gorm:"not null;default:0" json:"position"`    // Order within the post, from 0
+	StorageKey string    `gorm:"type:varchar(255)" json:"-"`            // Key on the storage backend; empty for linked URLs
+	Width      int       `json:"width,omitempty"`                       // Pixel dimensions of uploaded images
+	Height     int       `json:"height,omitempty"`
+	Blurhash   string    `gorm:"type:varchar(64)" json:"blurhash,omitempty"` // Placeholder shown while the image loads
+	BlobID     *uint     `gorm:"index" json:"-"`                             // Stored file shared by identical uploads
+	Size       int64     `gorm:"not null;default:0" json:"size"`             // Bytes charged to the uploader's quota
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Resized copies of uploaded images, smallest first
+	Variants []MediaVariant `gorm:"foreignKey:MediaID" json:"variants"`
 
 	// Relationships (optional, PostID/UserID are the main links)
 	// Post Post `gorm:"foreignKey:PostID"`
 	// User User `gorm:"foreignKey:UserID"`
 }
+
+// MediaInOrder preloads posts' media in attachment order.
+func MediaInOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+// PreloadMedia preloads posts' media in attachment order along with each
+// one's variants.
+func PreloadMedia(db *gorm.DB) *gorm.DB {
+	return db.Preload("Media", MediaInOrder).Preload("Media.Variants", VariantsBySize)
+}
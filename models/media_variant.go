@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MediaVariant model
+// @Description MediaVariant is a resized copy of an uploaded image
+type MediaVariant struct {
+	ID         uint      `gorm:"primarykey" json:"-"`
+	MediaID    uint      `gorm:"index;not null" json:"-"`
+	Name       string    `gorm:"type:varchar(20);not null" json:"name"` // 'small', 'medium' or 'large'
+	URL        string    `gorm:"type:varchar(255);not null" json:"url"`
+	StorageKey string    `gorm:"type:varchar(255)" json:"-"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	CreatedAt  time.Time `json:"-"`
+}
+
+// VariantsBySize preloads media variants smallest first.
+func VariantsBySize(db *gorm.DB) *gorm.DB {
+	return db.Order("width, id")
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Mute records that MuterID no longer wants to see MutedID's posts and
+// comments. Unlike a block, the muted user is not told and is not affected.
+type Mute struct {
+	ID        uint `gorm:"primarykey"`
+	MuterID   uint `gorm:"not null;uniqueIndex:idx_mutes_pair"`
+	MutedID   uint `gorm:"not null;uniqueIndex:idx_mutes_pair"`
+	CreatedAt time.Time
+}
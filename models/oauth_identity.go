@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// OAuthIdentity links an account at an external identity provider to a user.
+// A (Provider, Subject) pair identifies exactly one user.
+type OAuthIdentity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Provider  string    `gorm:"type:varchar(50);uniqueIndex:idx_oauth_provider_subject;not null" json:"provider"`
+	Subject   string    `gorm:"type:varchar(255);uniqueIndex:idx_oauth_provider_subject;not null" json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
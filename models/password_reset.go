@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PasswordReset is a single-use password reset token. Only the SHA-256 hash
+// of the emailed token is stored.
+type PasswordReset struct {
+	ID        uint      `gorm:"primarykey"`
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
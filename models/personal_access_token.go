@@ -0,0 +1,56 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// PersonalAccessTokenPrefix marks a bearer token as a personal access token
+// rather than a JWT.
+const PersonalAccessTokenPrefix = "shp_"
+
+// TokenScopes lists the scopes a personal access token can be granted. A
+// ":write" scope also grants the matching ":read" scope.
+var TokenScopes = []string{
+	"users:read", "users:write",
+	"posts:read", "posts:write",
+	"comments:read", "comments:write",
+	"ai:read", "ai:write",
+	"agent:read", "agent:write",
+}
+
+// PersonalAccessToken is a long-lived credential for scripts and
+// integrations. Only a hash of the secret is stored.
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	Hint       string     `json:"hint"`              // first characters of the token, to tell tokens apart
+	Scopes     string     `gorm:"not null" json:"-"` // space-separated
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// ScopeList returns the token's scopes.
+func (t *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// IsActive reports whether the token can still be used at the given time.
+func (t *PersonalAccessToken) IsActive(now time.Time) bool {
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
+
+// IsValidTokenScope reports whether scope is one of TokenScopes.
+func IsValidTokenScope(scope string) bool {
+	for _, s := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
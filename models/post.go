@@ -18,3 +18,13 @@ type Post struct {
 	Likes    []Like    `json:"likes" gorm:"foreignKey:PostID"`
 	Comments []Comment `json:"comments" gorm:"foreignKey:PostID"`
 }
+
+// PreloadInteractions returns a query scope that preloads posts' likes and
+// comments, leaving out those by users viewerID has blocked, been blocked by
+// or muted, and comments by private users viewerID does not follow.
+func PreloadInteractions(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Likes", HideBlockedAndMuted(viewerID, "user_id")).
+			Preload("Comments", HideBlockedAndMuted(viewerID, "user_id"), HidePrivate(viewerID, "user_id"))
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RecoveryCode is a single-use backup code for two-factor authentication.
+// Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"index;not null"`
+	CodeHash  string `gorm:"type:varchar(64);index;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RevokedToken is a blacklisted access token, identified by its SHA-256 hash.
+type RevokedToken struct {
+	ID        uint      `gorm:"primarykey"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	CreatedAt time.Time
+}
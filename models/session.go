@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session represents a single logged-in device. Each session owns one
+// refresh token (stored hashed) which is rotated every time it is used. The
+// token it replaced is kept so that reusing it can be detected.
+type Session struct {
+	gorm.Model
+	UserID            uint       `gorm:"index;not null" json:"user_id"`
+	RefreshTokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	PreviousTokenHash string     `gorm:"index" json:"-"`
+	Device            string     `json:"device"`
+	IP                string     `json:"ip"`
+	UserAgent         string     `json:"user_agent"`
+	LastSeenAt        time.Time  `json:"last_seen_at"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// IsActive reports whether the session can still be used at the given time.
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
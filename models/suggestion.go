@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Suggestion is a cached "who to follow" entry for UserID. A user's whole
+// list is replaced at once when it is recomputed, and User.SuggestionsComputedAt
+// records when.
+type Suggestion struct {
+	ID          uint `gorm:"primarykey"`
+	UserID      uint `gorm:"not null;index"`
+	SuggestedID uint `gorm:"not null;index"`
+	Position    int  `gorm:"not null"`
+	Score       int64
+	// How many of the people UserID follows follow SuggestedID.
+	FollowedBy int64
+	CreatedAt  time.Time
+}
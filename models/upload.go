@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Upload is a direct upload session. The client sends a file straight to
+// storage under StorageKey, then completes the upload to turn it into
+// media. Backends that cannot presign uploads receive the file through the
+// API instead, authorised by a token of which only the SHA-256 hash is
+// stored.
+type Upload struct {
+	ID          uint      `gorm:"primarykey"`
+	UserID      uint      `gorm:"index;not null"`
+	StorageKey  string    `gorm:"type:varchar(255);not null"`
+	ContentType string    `gorm:"type:varchar(100);not null"`
+	Size        int64     `gorm:"not null"` // As declared by the client
+	TokenHash   string    `gorm:"type:varchar(64);index"`
+	ExpiresAt   time.Time `gorm:"index;not null"`
+	// Set once the upload is completed, to the media it became.
+	CompletedAt *time.Time
+	MediaID     *uint
+	CreatedAt   time.Time
+}
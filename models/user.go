@@ -1,20 +1,75 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// User roles, from least to most privileged.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// IsValidRole reports whether role is one of the known roles.
+func IsValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
 type User struct {
 	gorm.Model
 	Email          string `gorm:"unique;not null" json:"email"`
 	Password       string `json:"-"` // omit in JSON responses
 	ProfilePicture string `json:"profile_picture"`
+	// Storage key of an uploaded profile picture; empty when there is none
+	// or it is hosted elsewhere.
+	AvatarKey      string `json:"-"`
 	Name           string `json:"name"`
 	Username       string `gorm:"unique" json:"username"`
 	Bio            string `json:"bio"`
 	FollowerCount  int64  `json:"follower_count" gorm:"default:0"`
 	FollowingCount int64  `json:"following_count" gorm:"default:0"`
 
+	// Account state below is for the user and admins only; it is left out
+	// of the author embedded in posts and comments.
+	EmailVerifiedAt *time.Time `json:"-"`
+
+	Role string `gorm:"not null;default:'user';index" json:"-"`
+	// Suspended users cannot log in or use existing tokens.
+	SuspendedAt      *time.Time `json:"-"`
+	SuspensionReason string     `json:"-"`
+
+	// Set when the user asks to delete their account; the account and its
+	// content are purged once this time has passed.
+	DeletionScheduledAt *time.Time `gorm:"index" json:"-"`
+
+	// Only approved followers can see a private user's posts, comments and
+	// follower lists; following them needs their approval.
+	IsPrivate bool `gorm:"not null;default:false" json:"is_private"`
+
+	// TOTP two-factor authentication. TOTPSecret is set during enrolment and
+	// only enforced once TwoFactorEnabled is true. TOTPLastStep stores the
+	// last accepted time step so a code cannot be replayed.
+	TwoFactorEnabled bool   `json:"-" gorm:"default:false"`
+	TOTPSecret       string `json:"-"`
+	TOTPLastStep     int64  `json:"-" gorm:"default:0"`
+
+	// Bytes of uploaded media charged against the user's storage quota.
+	StorageUsed int64 `json:"-" gorm:"not null;default:0"`
+
+	// When the user's follow suggestions were last computed, even if none
+	// were found; nil until they first ask.
+	SuggestionsComputedAt *time.Time `json:"-" gorm:"index"`
+
 	Posts    []Post    `json:"posts" gorm:"foreignKey:UserID"`
 	Comments []Comment `json:"comments" gorm:"foreignKey:UserID"`
 	Likes    []Like    `json:"likes" gorm:"foreignKey:UserID"`
@@ -22,3 +77,60 @@ type User struct {
 	Followers []*User `gorm:"many2many:follows;joinForeignKey:FollowingID;joinReferences:FollowerID" json:"followers"`
 	Following []*User `gorm:"many2many:follows;joinForeignKey:FollowerID;joinReferences:FollowingID" json:"following"`
 }
+
+// HasRole reports whether the user's role is at least as privileged as role.
+func (u *User) HasRole(role string) bool {
+	return roleRank[u.Role] >= roleRank[role] && roleRank[role] > 0
+}
+
+// Outranks reports whether the user's role is strictly more privileged than
+// other's.
+func (u *User) Outranks(other *User) bool {
+	return roleRank[u.Role] > roleRank[other.Role]
+}
+
+// IsSuspended reports whether the account is currently suspended.
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// IsVisible reports whether other users can see the account. Suspended
+// accounts and accounts scheduled for deletion are hidden.
+func (u *User) IsVisible() bool {
+	return u.SuspendedAt == nil && u.DeletionScheduledAt == nil
+}
+
+// VisibleUsers is a query scope matching the users for whom IsVisible holds.
+func VisibleUsers(db *gorm.DB) *gorm.DB {
+	return db.Where("users.suspended_at IS NULL AND users.deletion_scheduled_at IS NULL")
+}
+
+// CanSeeContent reports whether viewerID may see the posts, comments and
+// follower lists of ownerID: always for public accounts and for the owner,
+// otherwise only for approved followers.
+func CanSeeContent(db *gorm.DB, viewerID, ownerID uint) (bool, error) {
+	if viewerID == ownerID {
+		return true, nil
+	}
+	var owner User
+	if err := db.Select("id", "is_private").First(&owner, ownerID).Error; err != nil {
+		return false, err
+	}
+	if !owner.IsPrivate {
+		return true, nil
+	}
+	var count int64
+	err := db.Model(&Follow{}).
+		Where("follower_id = ? AND following_id = ?", viewerID, ownerID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// HidePrivate returns a query scope that drops rows whose column refers to a
+// private user that viewerID does not follow.
+func HidePrivate(viewerID uint, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+` NOT IN (SELECT id FROM users WHERE is_private = ? AND id <> ?
+			AND id NOT IN (SELECT following_id FROM follows WHERE follower_id = ?))`, true, viewerID, viewerID)
+	}
+}
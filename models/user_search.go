@@ -0,0 +1,186 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MaxSearchLength is the longest search term we look at; longer terms are
+// cut short.
+const MaxSearchLength = 50
+
+// userSearchFTS is set by SetupUserSearch when SQLite has FTS5 and the
+// users_fts index exists. Without it searches scan the users table instead.
+var userSearchFTS bool
+
+// userSearchTriggers keep users_fts in step with the users table.
+var userSearchTriggers = map[string]string{
+	"users_fts_insert": `CREATE TRIGGER users_fts_insert AFTER INSERT ON users BEGIN
+		INSERT INTO users_fts(rowid, username, name) VALUES (new.id, new.username, new.name);
+	END`,
+	"users_fts_delete": `CREATE TRIGGER users_fts_delete AFTER DELETE ON users BEGIN
+		INSERT INTO users_fts(users_fts, rowid, username, name) VALUES ('delete', old.id, old.username, old.name);
+	END`,
+	"users_fts_update": `CREATE TRIGGER users_fts_update AFTER UPDATE OF username, name ON users BEGIN
+		INSERT INTO users_fts(users_fts, rowid, username, name) VALUES ('delete', old.id, old.username, old.name);
+		INSERT INTO users_fts(rowid, username, name) VALUES (new.id, new.username, new.name);
+	END`,
+}
+
+// SetupUserSearch creates the users_fts index and the triggers that
+// maintain it, for SearchUsers to use. The driver only includes FTS5 when
+// built with the sqlite_fts5 tag; without it searches scan the users table.
+// A binary without FTS5 cannot write to users once the triggers exist, but
+// it must not drop them either, or the index would silently fall behind, so
+// SetupUserSearch returns an error then.
+func SetupUserSearch(db *gorm.DB) error {
+	var enabled int64
+	if err := db.Raw("SELECT COUNT(*) FROM pragma_compile_options WHERE compile_options = 'ENABLE_FTS5'").Scan(&enabled).Error; err != nil {
+		return err
+	}
+	if enabled == 0 {
+		names := make([]string, 0, len(userSearchTriggers))
+		for name := range userSearchTriggers {
+			names = append(names, name)
+		}
+		var triggers int64
+		if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ?", names).Scan(&triggers).Error; err != nil {
+			return err
+		}
+		if triggers > 0 {
+			return errors.New("the users_fts index was created by a build with FTS5; build with -tags sqlite_fts5")
+		}
+		userSearchFTS = false
+		log.Println("User search: scanning the users table (build with -tags sqlite_fts5 to index it)")
+		return nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+			username, name, content='users', content_rowid='id', tokenize='trigram')`).Error; err != nil {
+			return err
+		}
+		rebuild := false
+		for name, ddl := range userSearchTriggers {
+			var count int64
+			if err := tx.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", name).Scan(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				if err := tx.Exec(ddl).Error; err != nil {
+					return err
+				}
+				rebuild = true
+			}
+		}
+		// A missing trigger means users may have changed without the index
+		// seeing it, so build it again from the users table.
+		if rebuild {
+			return tx.Exec("INSERT INTO users_fts(users_fts) VALUES ('rebuild')").Error
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("creating the users_fts index: %w", err)
+	}
+	userSearchFTS = true
+	log.Println("User search: SQLite FTS5 index")
+	return nil
+}
+
+// NormalizeSearchTerm lower-cases and trims a search term, drops a leading
+// @ and cuts it to MaxSearchLength characters.
+func NormalizeSearchTerm(term string) string {
+	term = strings.TrimPrefix(strings.TrimSpace(term), "@")
+	term = strings.ToLower(strings.TrimSpace(term))
+	if runes := []rune(term); len(runes) > MaxSearchLength {
+		term = string(runes[:MaxSearchLength])
+	}
+	return term
+}
+
+// SearchUsers returns a query over the visible users matching term, which
+// must already be normalized, and not blocked by or blocking viewerID. Each
+// row carries the users columns plus:
+//
+//   - match_rank: 3 for an exact username, 2 when the username, the name or
+//     a word of the name starts with term, 1 when term appears anywhere and
+//     0 for a fuzzy match, which shares at least half of term's trigrams.
+//   - relation_rank: 3 for mutual follows, 2 when viewerID follows the user
+//     and 1 when the user follows viewerID.
+//
+// Order by match_rank, relation_rank, follower_count and id, all descending.
+func SearchUsers(db *gorm.DB, viewerID uint, term string) *gorm.DB {
+	like := escapeLike(term)
+	haystack := "LOWER(users.username || ' ' || users.name)"
+
+	matchRank := `CASE
+		WHEN LOWER(users.username) = ? THEN 3
+		WHEN LOWER(users.username) LIKE ? ESCAPE '\' OR LOWER(users.name) LIKE ? ESCAPE '\'
+			OR LOWER(users.name) LIKE ? ESCAPE '\' THEN 2
+		WHEN instr(` + haystack + `, ?) > 0 THEN 1
+		ELSE 0 END`
+	args := []interface{}{term, like + "%", like + "%", "% " + like + "%", term}
+
+	relationRank := `CASE WHEN users.id IN (SELECT following_id FROM follows WHERE follower_id = ?) THEN 2 ELSE 0 END
+		+ CASE WHEN users.id IN (SELECT follower_id FROM follows WHERE following_id = ?) THEN 1 ELSE 0 END`
+	args = append(args, viewerID, viewerID)
+
+	// overlap counts how many of term's trigrams the user shares.
+	grams := trigrams(term)
+	overlap := "0"
+	if len(grams) > 0 {
+		parts := make([]string, len(grams))
+		for i, g := range grams {
+			parts[i] = "(instr(" + haystack + ", ?) > 0)"
+			args = append(args, g)
+		}
+		overlap = strings.Join(parts, " + ")
+	}
+
+	query := db.Model(&User{}).
+		Select("users.*, "+matchRank+" AS match_rank, "+relationRank+" AS relation_rank, "+overlap+" AS overlap", args...).
+		Scopes(VisibleUsers, HideBlocked(viewerID, "users.id"))
+
+	if len(grams) == 0 {
+		// Too short for trigrams: prefix matches only.
+		return db.Table("(?) AS results", query).Where("match_rank >= 2")
+	}
+
+	// Every match shares at least one trigram with term, so the index can
+	// narrow down the candidates.
+	if userSearchFTS {
+		quoted := make([]string, len(grams))
+		for i, g := range grams {
+			quoted[i] = `"` + strings.ReplaceAll(g, `"`, `""`) + `"`
+		}
+		query = query.Where("users.id IN (SELECT rowid FROM users_fts WHERE users_fts MATCH ?)", strings.Join(quoted, " OR "))
+	}
+
+	return db.Table("(?) AS results", query).
+		Where("match_rank > 0 OR overlap >= ?", (len(grams)+1)/2)
+}
+
+// trigrams returns the distinct three-character substrings of term.
+func trigrams(term string) []string {
+	runes := []rune(term)
+	seen := map[string]bool{}
+	var grams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		g := string(runes[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			grams = append(grams, g)
+		}
+	}
+	return grams
+}
+
+// escapeLike escapes the LIKE wildcards in s for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,38 @@
+package models_test
+
+import (
+	"testing"
+
+	"socialmedia/internal/testutil"
+	"socialmedia/models"
+)
+
+// A build without FTS5 must leave the index of a build with it alone.
+func TestSetupUserSearchKeepsIndexWithoutFTS5(t *testing.T) {
+	db := testutil.NewDB(t)
+	var enabled int64
+	if err := db.Raw("SELECT COUNT(*) FROM pragma_compile_options WHERE compile_options = 'ENABLE_FTS5'").Scan(&enabled).Error; err != nil {
+		t.Fatal(err)
+	}
+	if enabled != 0 {
+		t.Skip("built with FTS5")
+	}
+
+	// Left behind by a build with FTS5.
+	if err := db.Exec(`CREATE TRIGGER users_fts_insert AFTER INSERT ON users BEGIN
+		INSERT INTO users_fts(rowid, username, name) VALUES (new.id, new.username, new.name);
+	END`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := models.SetupUserSearch(db); err == nil {
+		t.Error("SetupUserSearch() succeeded without FTS5 on an indexed database")
+	}
+	var triggers int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'users_fts_insert'").Scan(&triggers).Error; err != nil {
+		t.Fatal(err)
+	}
+	if triggers != 1 {
+		t.Error("the trigger was dropped")
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UsernameHistory records a username a user has given up, so that mentions
+// and links using the old name still find them. An old username stays
+// reserved for its previous owner.
+type UsernameHistory struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"index;not null"`
+	Username  string `gorm:"index;not null"`
+	CreatedAt time.Time
+}
+
+// FindUserByUsername looks a user up by their current username or, failing
+// that, by one they used before. Matching is case-insensitive.
+func FindUserByUsername(db *gorm.DB, username string) (User, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	var user User
+	err := db.Where("LOWER(username) = ?", username).First(&user).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	var history UsernameHistory
+	if err := db.Where("LOWER(username) = ?", username).Order("created_at desc").First(&history).Error; err != nil {
+		return user, err
+	}
+	return user, db.First(&user, history.UserID).Error
+}
+
+// UsernameTaken reports whether username is in use by, or reserved for,
+// anyone other than userID.
+func UsernameTaken(db *gorm.DB, username string, userID uint) (bool, error) {
+	username = strings.ToLower(username)
+
+	var count int64
+	if err := db.Unscoped().Model(&User{}).
+		Where("LOWER(username) = ? AND id <> ?", username, userID).
+		Count(&count).Error; err != nil || count > 0 {
+		return count > 0, err
+	}
+	if err := db.Model(&UsernameHistory{}).
+		Where("LOWER(username) = ? AND user_id <> ?", username, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"strings"
+
+	"socialmedia/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// uploadRoute is a route that accepts files, as a multipart form or, for
+// direct uploads, as the raw body. files is how many files it takes.
+type uploadRoute struct {
+	method, path string
+	files        func() int
+}
+
+func oneFile() int { return 1 }
+
+func maxFiles() int { return config.MaxUploadFiles }
+
+// uploadRoutes holds the routes registered with acceptFiles.
+var uploadRoutes []uploadRoute
+
+// acceptFiles registers a route that accepts files, taking at most files()
+// of them, so that BodyLimit lets its requests carry them.
+func acceptFiles(router fiber.Router, method, path string, files func() int, handlers ...fiber.Handler) {
+	router.Add(method, path, handlers...)
+	if group, ok := router.(*fiber.Group); ok {
+		path = group.Prefix + path
+	}
+	uploadRoutes = append(uploadRoutes, uploadRoute{method, path, files})
+}
+
+// BodyLimit sets how large a request's body may be once its headers have
+// been read, before the body is. Routes accepting files may take their
+// files at MaxUploadSize each plus the rest of the form; everything else,
+// including the public auth routes, is held to RequestBodyLimit. Use it as
+// the server's HeaderReceived hook, once Setup has registered the routes.
+func BodyLimit(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	path, _, _ := strings.Cut(string(header.RequestURI()), "?")
+	method := string(header.Method())
+	for _, route := range uploadRoutes {
+		if route.method == method && matchPath(route.path, path) {
+			return fasthttp.RequestConfig{
+				MaxRequestBodySize: int(config.MaxUploadSize)*route.files() + config.RequestBodyLimit,
+			}
+		}
+	}
+	return fasthttp.RequestConfig{MaxRequestBodySize: config.RequestBodyLimit}
+}
+
+// matchPath reports whether path matches pattern, where a ":name" segment
+// matches any one non-empty segment.
+func matchPath(pattern, path string) bool {
+	want := strings.Split(pattern, "/")
+	got := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if strings.HasPrefix(want[i], ":") {
+			if got[i] == "" {
+				return false
+			}
+		} else if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"socialmedia/config"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBodyLimit(t *testing.T) {
+	config.RequestBodyLimit = 1 << 10
+	config.MaxUploadSize = 4 << 10
+	config.MaxUploadFiles = 3
+
+	app := fiber.New(fiber.Config{BodyLimit: config.RequestBodyLimit})
+	app.Server().HeaderReceived = BodyLimit
+	app.Use(func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	Setup(app)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	tests := []struct {
+		method, path string
+		size         int
+		want         int
+	}{
+		{http.MethodPost, "/api/login", 1 << 10, fiber.StatusOK},
+		{http.MethodPost, "/api/login", 1<<10 + 1, fiber.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/api/register", 4 << 10, fiber.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/api/media", 5 << 10, fiber.StatusOK},
+		{http.MethodPost, "/api/media?x=1", 5<<10 + 1, fiber.StatusRequestEntityTooLarge},
+		{http.MethodPut, "/api/uploads/7", 5 << 10, fiber.StatusOK},
+		{http.MethodPut, "/api/uploads/", 5 << 10, fiber.StatusRequestEntityTooLarge},
+		{http.MethodPut, "/api/uploads/7/complete", 5 << 10, fiber.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/api/profile/avatar", 5 << 10, fiber.StatusOK},
+		{http.MethodPost, "/api/posts", 13 << 10, fiber.StatusOK},
+		{http.MethodPut, "/api/posts/3", 13 << 10, fiber.StatusOK},
+		{http.MethodDelete, "/api/posts/3", 13 << 10, fiber.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/api/ai-posts", 13 << 10, fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "http://"+ln.Addr().String()+tt.path, bytes.NewReader(make([]byte, tt.size)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s with %d bytes = %d, want %d", tt.method, tt.path, tt.size, resp.StatusCode, tt.want)
+		}
+	}
+}
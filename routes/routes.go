@@ -5,7 +5,10 @@ import (
 	"socialmedia/controllers"
 	"socialmedia/handlers"
 	"socialmedia/middlewares"
+	"socialmedia/models"
 	"socialmedia/services/ai"
+	"socialmedia/services/loginguard"
+	"socialmedia/services/oidc"
 	"socialmedia/services/project"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,58 +17,155 @@ import (
 func Setup(app *fiber.App) {
 	aiService := ai.NewAIService(config.OpenRouterAPIKey, config.AIModel)
 	projectService := project.NewService(aiService)
+	identityProviders := oidc.NewRegistry(config.OIDCProviders)
+
+	guardConfig := loginguard.DefaultConfig()
+	guardConfig.MaxFailures = config.LoginMaxFailures
+	guardConfig.IPMaxFailures = config.LoginIPMaxFailures
+	guardConfig.Window = config.LoginFailureWindow
+	guardConfig.LockoutDuration = config.LoginLockoutDuration
+	loginGuard := loginguard.New(models.DB, guardConfig)
+
+	app.Get("/.well-known/jwks.json", controllers.JWKS)
+	app.Get("/media/*", controllers.ServeMedia)
+
 	api := app.Group("/api")
 
 	// Public routes.
 	api.Post("/register", controllers.Register)
-	api.Post("/login", controllers.Login)
-	api.Get("/auth/google", controllers.GoogleLogin)
-	api.Get("/auth/google/callback", controllers.GoogleCallback)
+	api.Post("/login", controllers.Login(loginGuard))
+	api.Post("/login/2fa", controllers.LoginTwoFactor(loginGuard))
+	api.Post("/login/magic", controllers.RequestMagicLink)
+	api.Get("/login/magic/verify", controllers.VerifyMagicLink)
+	api.Get("/auth/:provider", controllers.OAuthLogin(identityProviders))
+	api.Get("/auth/:provider/callback", controllers.OAuthCallback(identityProviders))
 	api.Post("/logout", controllers.Logout)
+	api.Post("/token/refresh", controllers.RefreshToken)
+	api.Post("/password/forgot", controllers.ForgotPassword)
+	api.Post("/password/reset", controllers.ResetPassword)
+	api.Get("/verify-email", controllers.VerifyEmail)
+	// Authorised by the token in the URL handed out by POST /api/uploads.
+	acceptFiles(api, fiber.MethodPut, "/uploads/:id", oneFile, controllers.ReceiveUpload)
 
-	// Protected routes (require JWT authentication).
+	// Protected routes (require a JWT or personal access token).
 	api.Use(middlewares.JWTMiddleware)
 
+	// Write routes additionally require a verified email when
+	// REQUIRE_EMAIL_VERIFICATION is enabled.
+	verified := middlewares.RequireVerifiedEmail
+
+	// Account management is only available to interactive logins, never to
+	// personal access tokens.
+	session := middlewares.RequireSession
+
+	api.Post("/verify-email/resend", session, controllers.ResendVerificationEmail)
+
+	// Two-factor authentication routes.
+	api.Post("/2fa/setup", session, controllers.SetupTwoFactor)
+	api.Post("/2fa/enable", session, controllers.EnableTwoFactor)
+	api.Post("/2fa/disable", session, controllers.DisableTwoFactor)
+	api.Post("/2fa/recovery-codes", session, controllers.RegenerateRecoveryCodes)
+
+	// Linked account routes.
+	api.Post("/auth/:provider/link", session, controllers.LinkOAuth(identityProviders))
+	api.Get("/identities", session, controllers.ListIdentities)
+	api.Delete("/identities/:id", session, controllers.UnlinkIdentity)
+
+	// Session routes.
+	api.Get("/sessions", session, controllers.ListSessions)
+	api.Delete("/sessions/:id", session, controllers.RevokeSession)
+
+	// Account export and deletion.
+	api.Get("/me/export", session, controllers.ExportAccount)
+	api.Delete("/me", session, controllers.DeleteAccount)
+	api.Post("/me/deletion/cancel", session, controllers.CancelAccountDeletion)
+
+	// Personal access token routes.
+	api.Get("/tokens", session, controllers.ListTokens)
+	api.Post("/tokens", session, controllers.CreateToken)
+	api.Get("/tokens/:id", session, controllers.GetToken)
+	api.Patch("/tokens/:id", session, controllers.UpdateToken)
+	api.Delete("/tokens/:id", session, controllers.DeleteToken)
+
+	// Admin routes. Moderators can manage users and content; changing roles
+	// is reserved for admins.
+	admin := api.Group("/admin", session, middlewares.RequireRole(models.RoleModerator))
+	admin.Get("/stats", controllers.AdminStats)
+	admin.Get("/users", controllers.AdminListUsers)
+	admin.Get("/users/:id", controllers.AdminGetUser)
+	admin.Post("/users/:id/suspend", controllers.AdminSuspendUser)
+	admin.Post("/users/:id/unsuspend", controllers.AdminUnsuspendUser)
+	admin.Put("/users/:id/role", middlewares.RequireRole(models.RoleAdmin), controllers.AdminUpdateRole)
+	admin.Delete("/posts/:id", controllers.AdminDeletePost)
+	admin.Delete("/comments/:id", controllers.AdminDeleteComment)
+	admin.Post("/follows/reconcile", middlewares.RequireRole(models.RoleAdmin), controllers.AdminReconcileFollowCounts)
+
+	// Personal access tokens may only reach the routes their scopes cover.
+	usersScope := middlewares.RequireScope("users")
+	postsScope := middlewares.RequireScope("posts")
+	commentsScope := middlewares.RequireScope("comments")
+	aiScope := middlewares.RequireScope("ai")
+
 	// User routes.
-	api.Get("/profile", controllers.GetProfile)
-	api.Post("/follow/:id", controllers.FollowUser)
-	api.Post("/unfollow/:id", controllers.UnfollowUser)
+	api.Get("/profile", usersScope, controllers.GetProfile)
+	api.Patch("/profile", usersScope, controllers.UpdateProfile)
+	acceptFiles(api, fiber.MethodPost, "/profile/avatar", oneFile, usersScope, controllers.UploadAvatar)
+	api.Get("/users/search", usersScope, controllers.SearchUsers)
+	api.Get("/users/suggestions", usersScope, controllers.GetSuggestions)
+	api.Get("/users/:username", usersScope, controllers.GetUserByUsername)
+	api.Get("/users/:id/posts", postsScope, controllers.GetUserPosts)
+	api.Get("/users/:id/followers", usersScope, controllers.GetFollowers)
+	api.Get("/users/:id/following", usersScope, controllers.GetFollowing)
+	api.Post("/users/:id/block", usersScope, controllers.BlockUser)
+	api.Delete("/users/:id/block", usersScope, controllers.UnblockUser)
+	api.Post("/users/:id/mute", usersScope, controllers.MuteUser)
+	api.Delete("/users/:id/mute", usersScope, controllers.UnmuteUser)
+	api.Get("/blocks", usersScope, controllers.ListBlocks)
+	api.Get("/mutes", usersScope, controllers.ListMutes)
+	api.Get("/follow-requests", usersScope, controllers.ListFollowRequests)
+	api.Post("/follow-requests/:id/approve", usersScope, controllers.ApproveFollowRequest)
+	api.Post("/follow-requests/:id/reject", usersScope, controllers.RejectFollowRequest)
+	api.Post("/follow/:id", usersScope, verified, controllers.FollowUser)
+	api.Post("/unfollow/:id", usersScope, controllers.UnfollowUser)
 
 	// Post routes.
-	api.Get("/posts", controllers.PostList)
-	api.Post("/posts", controllers.CreatePost)
-	api.Put("/posts/:id", controllers.EditPost)
-	api.Delete("/posts/:id", controllers.DeletePost)
-	api.Get("/timeline", controllers.Timeline)
+	api.Get("/posts", postsScope, controllers.PostList)
+	acceptFiles(api, fiber.MethodPost, "/media", oneFile, postsScope, verified, controllers.UploadMedia)
+	api.Post("/uploads", postsScope, verified, controllers.CreateUpload)
+	api.Post("/uploads/:id/complete", postsScope, verified, controllers.CompleteUpload)
+	acceptFiles(api, fiber.MethodPost, "/posts", maxFiles, postsScope, verified, controllers.CreatePost)
+	acceptFiles(api, fiber.MethodPut, "/posts/:id", maxFiles, postsScope, verified, controllers.EditPost)
+	api.Delete("/posts/:id", postsScope, controllers.DeletePost)
+	api.Get("/timeline", postsScope, controllers.Timeline)
 
 	// Comment routes.
-	api.Get("/posts/:id/comments", controllers.GetCommentsByPostID)
-	api.Get("/comments/:id", controllers.GetCommentByID)
-	api.Post("/posts/:id/comments", controllers.AddComment)
-	api.Put("/comments/:id", controllers.EditComment)
-	api.Delete("/comments/:id", controllers.DeleteComment)
-	api.Post("/comments/:id/replies", controllers.AddReply)
+	api.Get("/posts/:id/comments", commentsScope, controllers.GetCommentsByPostID)
+	api.Get("/comments/:id", commentsScope, controllers.GetCommentByID)
+	api.Post("/posts/:id/comments", commentsScope, verified, controllers.AddComment)
+	api.Put("/comments/:id", commentsScope, verified, controllers.EditComment)
+	api.Delete("/comments/:id", commentsScope, controllers.DeleteComment)
+	api.Post("/comments/:id/replies", commentsScope, verified, controllers.AddReply)
 
 	// Like routes.
-	api.Post("/posts/:id/like", controllers.LikePost)
-	api.Delete("/posts/:id/like", controllers.UnlikePost)
+	api.Post("/posts/:id/like", postsScope, verified, controllers.LikePost)
+	api.Delete("/posts/:id/like", postsScope, controllers.UnlikePost)
 
 	// AI Chat Post routes.
-	api.Post("/ai-posts", controllers.CreateAIChatPost)
+	acceptFiles(api, fiber.MethodPost, "/ai-posts", maxFiles, aiScope, verified, controllers.CreateAIChatPost)
 	// api.Post("/ai-posts/:id/messages", controllers.AddChatMessage)
-	api.Post("/ai-posts/:id/messages", controllers.SendAIChatMessage)
-	api.Get("/ai-posts/:id", controllers.GetAIChatPost)
+	api.Post("/ai-posts/:id/messages", aiScope, verified, controllers.SendAIChatMessage)
+	api.Get("/ai-posts/:id", aiScope, controllers.GetAIChatPost)
 
 	// Protected routes
-	protected := api.Group("/agent")
+	protected := api.Group("/agent", middlewares.RequireScope("agent"))
 
 	// Project routes
-	protected.Post("/projects", handlers.CreateProject(projectService))
+	protected.Post("/projects", verified, handlers.CreateProject(projectService))
 	protected.Get("/projects", handlers.GetProjects())
 	protected.Get("/projects/:id", handlers.GetProject())
 
 	// Feature routes
-	protected.Post("/projects/:id/features", handlers.CreateFeature())
-	protected.Post("/features/:id/generate-prd", handlers.GeneratePRD(projectService))
+	protected.Post("/projects/:id/features", verified, handlers.CreateFeature())
+	protected.Post("/features/:id/generate-prd", verified, handlers.GeneratePRD(projectService))
 	protected.Get("/features/:id/prd", handlers.GetFeaturePRD())
 }
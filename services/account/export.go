@@ -0,0 +1,143 @@
+// Package account implements whole-account operations: exporting a user's
+// data and permanently deleting it.
+package account
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"socialmedia/models"
+
+	"gorm.io/gorm"
+)
+
+// exportTable describes one JSON file in an export: the rows of a model's
+// table that belong to the user.
+type exportTable struct {
+	file  string
+	query func(db *gorm.DB, userID uint) *gorm.DB
+}
+
+// Columns that must never leave the server, even to their owner.
+var secretColumns = []string{"password", "totp_secret", "totp_last_step", "token_hash", "refresh_token_hash", "previous_token_hash", "code_hash"}
+
+var exportTables = []exportTable{
+	{"posts.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Post{}).Where("user_id = ?", id)
+	}},
+	{"comments.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Comment{}).Where("user_id = ?", id)
+	}},
+	{"likes.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Like{}).Where("user_id = ?", id)
+	}},
+	{"follows.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Follow{}).Where("follower_id = ? OR following_id = ?", id, id)
+	}},
+	{"media.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Media{}).Where("user_id = ?", id)
+	}},
+	{"media_variants.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.MediaVariant{}).Where("media_id IN (?)", db.Model(&models.Media{}).Select("id").Where("user_id = ?", id))
+	}},
+	{"uploads.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Upload{}).Where("user_id = ?", id)
+	}},
+	{"ai_chat_messages.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.ChatMessage{}).Where("post_id IN (?)", db.Model(&models.Post{}).Select("id").Where("user_id = ?", id))
+	}},
+	{"projects.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Project{}).Where("user_id = ?", id)
+	}},
+	{"technology_stacks.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.TechnologyStack{}).Where("user_id = ?", id)
+	}},
+	{"stack_items.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.StackItem{}).Where("user_id = ?", id)
+	}},
+	{"features.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Feature{}).Where("user_id = ?", id)
+	}},
+	{"prds.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Prd{}).Where("user_id = ?", id)
+	}},
+	{"sessions.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Session{}).Where("user_id = ?", id)
+	}},
+	{"linked_accounts.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.OAuthIdentity{}).Where("user_id = ?", id)
+	}},
+	{"access_tokens.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.PersonalAccessToken{}).Where("user_id = ?", id)
+	}},
+	{"username_history.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.UsernameHistory{}).Where("user_id = ?", id)
+	}},
+	{"blocks.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Block{}).Where("blocker_id = ?", id)
+	}},
+	{"mutes.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.Mute{}).Where("muter_id = ?", id)
+	}},
+	{"follow_requests.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.FollowRequest{}).Where("requester_id = ? OR target_id = ?", id, id)
+	}},
+	{"login_attempts.json", func(db *gorm.DB, id uint) *gorm.DB {
+		return db.Model(&models.LoginAttempt{}).Where("user_id = ?", id)
+	}},
+}
+
+// Export writes a ZIP archive of everything stored about the user to w: the
+// account itself in user.json and one JSON file per kind of content.
+func Export(db *gorm.DB, userID uint, w io.Writer) error {
+	// The columns rather than the model's JSON, which leaves out account
+	// state only the user should see.
+	user := map[string]interface{}{}
+	if err := db.Unscoped().Model(&models.User{}).Where("id = ?", userID).Take(&user).Error; err != nil {
+		return err
+	}
+	for _, column := range secretColumns {
+		delete(user, column)
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeJSON(archive, "user.json", user); err != nil {
+		return err
+	}
+
+	for _, table := range exportTables {
+		var rows []map[string]interface{}
+		if err := table.query(db, userID).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			for _, column := range secretColumns {
+				delete(row, column)
+			}
+		}
+		if rows == nil {
+			rows = []map[string]interface{}{}
+		}
+		if err := writeJSON(archive, table.file, rows); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeJSON(archive *zip.Writer, name string, v interface{}) error {
+	f, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
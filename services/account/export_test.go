@@ -0,0 +1,56 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"socialmedia/internal/testutil"
+	"socialmedia/models"
+)
+
+func TestExportIncludesAccountState(t *testing.T) {
+	db := testutil.NewDB(t)
+	now := time.Now()
+	user := models.User{
+		Email:           "alice@example.com",
+		Username:        "alice",
+		Password:        "hashed",
+		EmailVerifiedAt: &now,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Export(db, user.ID, &buf); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := archive.Open("user.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got["email"] != user.Email || got["email_verified_at"] == nil {
+		t.Errorf("user.json = %s, want the email and when it was verified", data)
+	}
+	if _, ok := got["password"]; ok {
+		t.Error("user.json has the password hash")
+	}
+}
@@ -0,0 +1,216 @@
+package account
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"socialmedia/models"
+	"socialmedia/services/storage"
+
+	"gorm.io/gorm"
+)
+
+// decrement is a portable "column - n, but never below zero".
+func decrement(column string, n int64) interface{} {
+	return gorm.Expr("CASE WHEN "+column+" > ? THEN "+column+" - ? ELSE 0 END", n, n)
+}
+
+// Purge permanently deletes a user and everything they own, in one
+// transaction. Counters on other users' posts, comments and profiles are
+// adjusted for the likes, comments and follows that disappear. Uploaded
+// files no other media shares are deleted from storage afterwards.
+func Purge(db *gorm.DB, userID uint) error {
+	var unused []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Unscoped().First(&user, userID).Error; err != nil {
+			return err
+		}
+		// A new session so every query below starts from clean conditions.
+		tx = tx.Unscoped().Session(&gorm.Session{})
+
+		postIDs := tx.Model(&models.Post{}).Select("id").Where("user_id = ?", userID)
+
+		// Likes the user gave to other people's posts and comments.
+		var likes []models.Like
+		if err := tx.Where("user_id = ?", userID).Find(&likes).Error; err != nil {
+			return err
+		}
+		for _, like := range likes {
+			if like.PostID != nil {
+				if err := tx.Model(&models.Post{}).Where("id = ?", *like.PostID).
+					UpdateColumn("like_count", decrement("like_count", 1)).Error; err != nil {
+					return err
+				}
+			}
+			if like.CommentID != nil {
+				if err := tx.Model(&models.Comment{}).Where("id = ?", *like.CommentID).
+					UpdateColumn("like_count", decrement("like_count", 1)).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// Comments the user wrote on other people's posts, with their replies.
+		var comments []models.Comment
+		if err := tx.Where("user_id = ? AND post_id NOT IN (?)", userID, postIDs).Find(&comments).Error; err != nil {
+			return err
+		}
+		for _, comment := range comments {
+			removed := int64(1)
+			if comment.ParentCommentID == nil {
+				result := tx.Where("parent_comment_id = ?", comment.ID).Delete(&models.Comment{})
+				if result.Error != nil {
+					return result.Error
+				}
+				removed += result.RowsAffected
+			}
+			if err := tx.Delete(&comment).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Post{}).Where("id = ?", comment.PostID).
+				UpdateColumn("comments_count", decrement("comments_count", removed)).Error; err != nil {
+				return err
+			}
+		}
+
+		// Follow relationships in both directions.
+		var follows []models.Follow
+		if err := tx.Where("follower_id = ? OR following_id = ?", userID, userID).Find(&follows).Error; err != nil {
+			return err
+		}
+		for _, follow := range follows {
+			if follow.DeletedAt.Valid {
+				continue
+			}
+			if follow.FollowerID == userID {
+				if err := tx.Model(&models.User{}).Where("id = ?", follow.FollowingID).
+					UpdateColumn("follower_count", decrement("follower_count", 1)).Error; err != nil {
+					return err
+				}
+			} else {
+				if err := tx.Model(&models.User{}).Where("id = ?", follow.FollowerID).
+					UpdateColumn("following_count", decrement("following_count", 1)).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// Media the user uploaded or that is on their posts, dropping its
+		// references to stored files.
+		var mediaIDs []uint
+		if err := tx.Model(&models.Media{}).Where("user_id = ? OR post_id IN (?)", userID, postIDs).
+			Pluck("id", &mediaIDs).Error; err != nil {
+			return err
+		}
+		var err error
+		if unused, err = models.DeleteMedia(tx, mediaIDs); err != nil {
+			return err
+		}
+		// Files sent for uploads that were never completed.
+		var pending []string
+		if err := tx.Model(&models.Upload{}).Where("user_id = ? AND completed_at IS NULL", userID).
+			Pluck("storage_key", &pending).Error; err != nil {
+			return err
+		}
+		unused = append(unused, pending...)
+		if user.AvatarKey != "" {
+			unused = append(unused, user.AvatarKey)
+		}
+
+		// Everything hanging off the user's own posts, then the rest of
+		// what they own. Order matters where rows reference each other.
+		deletes := []struct {
+			model interface{}
+			query string
+			args  []interface{}
+		}{
+			{&models.Like{}, "user_id = ? OR post_id IN (?) OR comment_id IN (?)", []interface{}{userID, postIDs, tx.Model(&models.Comment{}).Select("id").Where("post_id IN (?)", postIDs)}},
+			{&models.Comment{}, "post_id IN (?)", []interface{}{postIDs}},
+			{&models.ChatMessage{}, "post_id IN (?)", []interface{}{postIDs}},
+			{&models.Post{}, "user_id = ?", []interface{}{userID}},
+			{&models.Follow{}, "follower_id = ? OR following_id = ?", []interface{}{userID, userID}},
+			{&models.Prd{}, "user_id = ?", []interface{}{userID}},
+			{&models.Feature{}, "user_id = ?", []interface{}{userID}},
+			{&models.StackItem{}, "user_id = ?", []interface{}{userID}},
+			{&models.TechnologyStack{}, "user_id = ?", []interface{}{userID}},
+			{&models.Project{}, "user_id = ?", []interface{}{userID}},
+			{&models.Session{}, "user_id = ?", []interface{}{userID}},
+			{&models.PasswordReset{}, "user_id = ?", []interface{}{userID}},
+			{&models.EmailVerification{}, "user_id = ?", []interface{}{userID}},
+			{&models.RecoveryCode{}, "user_id = ?", []interface{}{userID}},
+			{&models.OAuthIdentity{}, "user_id = ?", []interface{}{userID}},
+			{&models.PersonalAccessToken{}, "user_id = ?", []interface{}{userID}},
+			{&models.LoginAttempt{}, "user_id = ? OR LOWER(email) = LOWER(?)", []interface{}{userID, user.Email}},
+			{&models.UsernameHistory{}, "user_id = ?", []interface{}{userID}},
+			{&models.Block{}, "blocker_id = ? OR blocked_id = ?", []interface{}{userID, userID}},
+			{&models.Mute{}, "muter_id = ? OR muted_id = ?", []interface{}{userID, userID}},
+			{&models.FollowRequest{}, "requester_id = ? OR target_id = ?", []interface{}{userID, userID}},
+			{&models.Suggestion{}, "user_id = ? OR suggested_id = ?", []interface{}{userID, userID}},
+			{&models.Upload{}, "user_id = ?", []interface{}{userID}},
+			{&models.MagicLink{}, "LOWER(email) = LOWER(?)", []interface{}{user.Email}},
+		}
+		for _, d := range deletes {
+			if err := tx.Where(d.query, d.args...).Delete(d.model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where(map[string]interface{}{"key": "account:" + strings.ToLower(strings.TrimSpace(user.Email))}).Delete(&models.LoginThrottle{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		return err
+	}
+	storage.DeleteAll(context.Background(), unused)
+	return nil
+}
+
+// PurgeDue purges every account whose deletion grace period has ended and
+// returns how many were removed.
+func PurgeDue(db *gorm.DB, now time.Time) (int, error) {
+	var ids []uint
+	if err := db.Unscoped().Model(&models.User{}).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", now).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err := Purge(db, id); err != nil {
+			log.Printf("Failed to purge user %d: %v", id, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// StartPurger periodically purges accounts that are due for deletion until
+// ctx is cancelled.
+func StartPurger(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				purged, err := PurgeDue(db, now)
+				if err != nil {
+					log.Printf("Account purge failed: %v", err)
+					continue
+				}
+				if purged > 0 {
+					log.Printf("Account purge deleted %d accounts", purged)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,172 @@
+package account
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"socialmedia/internal/testutil"
+	"socialmedia/models"
+	"socialmedia/services/storage"
+
+	"gorm.io/gorm"
+)
+
+func create(t *testing.T, db *gorm.DB, rows ...interface{}) {
+	t.Helper()
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("creating %T: %v", row, err)
+		}
+	}
+}
+
+func stored(backend storage.Backend, key string) bool {
+	r, err := backend.Get(context.Background(), key)
+	if err != nil {
+		return false
+	}
+	r.Close()
+	return true
+}
+
+func TestPurgeRemovesEverythingOwned(t *testing.T) {
+	db := testutil.NewDB(t)
+	backend := testutil.UseStorage(t)
+	now := time.Now()
+	for _, key := range []string{"media/alice", "media/alice-small", "media/bob", "uploads/alice", "avatars/alice"} {
+		if _, err := backend.Put(context.Background(), key, strings.NewReader("data"), 4, "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alice := models.User{Email: "alice@example.com", Username: "alice", Name: "Alice", AvatarKey: "avatars/alice"}
+	bob := models.User{Email: "bob@example.com", Username: "bob", Name: "Bob", FollowerCount: 1, FollowingCount: 1}
+	create(t, db, &alice, &bob)
+	alicePost := models.Post{UserID: alice.ID, Content: "alice"}
+	bobPost := models.Post{UserID: bob.ID, Content: "bob", LikeCount: 1, CommentsCount: 2}
+	create(t, db, &alicePost, &bobPost)
+
+	// Alice's like and comment on bob's post, and bob's reply to it.
+	aliceComment := models.Comment{UserID: alice.ID, PostID: bobPost.ID, Content: "hi"}
+	create(t, db, &models.Like{UserID: alice.ID, PostID: &bobPost.ID}, &aliceComment)
+	create(t, db, &models.Comment{UserID: bob.ID, PostID: bobPost.ID, ParentCommentID: &aliceComment.ID, Content: "hello"})
+	// Bob's like and comment on alice's post, and his like of that comment.
+	bobComment := models.Comment{UserID: bob.ID, PostID: alicePost.ID, Content: "nice"}
+	create(t, db, &models.Like{UserID: bob.ID, PostID: &alicePost.ID}, &bobComment)
+	create(t, db, &models.Like{UserID: bob.ID, CommentID: &bobComment.ID})
+
+	project := models.Project{UserID: alice.ID, Name: "project"}
+	create(t, db, &project)
+	stack := models.TechnologyStack{UserID: alice.ID, ProjectID: project.ID}
+	feature := models.Feature{UserID: alice.ID, ProjectID: project.ID, Name: "feature"}
+	create(t, db, &stack, &feature)
+
+	aliceMedia := models.Media{UserID: alice.ID, PostID: &alicePost.ID, Type: models.ImageType, URL: "/media/alice", StorageKey: "media/alice", Size: 4,
+		Variants: []models.MediaVariant{{Name: "small", URL: "/media/alice-small", StorageKey: "media/alice-small"}}}
+	bobMedia := models.Media{UserID: bob.ID, PostID: &bobPost.ID, Type: models.ImageType, URL: "/media/bob", StorageKey: "media/bob", Size: 4}
+
+	create(t, db,
+		&models.ChatMessage{PostID: alicePost.ID, Sender: "user", Content: "hi"},
+		&models.Follow{FollowerID: alice.ID, FollowingID: bob.ID},
+		&models.Follow{FollowerID: bob.ID, FollowingID: alice.ID},
+		&models.StackItem{UserID: alice.ID, TechStackID: stack.ID, Name: "Go"},
+		&models.Prd{UserID: alice.ID, FeatureID: feature.ID, Content: "prd"},
+		&models.Session{UserID: alice.ID, RefreshTokenHash: "session", LastSeenAt: now, ExpiresAt: now},
+		&models.PasswordReset{UserID: alice.ID, TokenHash: "reset", ExpiresAt: now},
+		&models.EmailVerification{UserID: alice.ID, TokenHash: "verification", ExpiresAt: now},
+		&models.RecoveryCode{UserID: alice.ID, CodeHash: "code"},
+		&models.OAuthIdentity{UserID: alice.ID, Provider: "google", Subject: "alice"},
+		&models.PersonalAccessToken{UserID: alice.ID, Name: "token", TokenHash: "token", Scopes: "posts"},
+		&models.LoginAttempt{UserID: &alice.ID, Email: alice.Email},
+		&models.LoginAttempt{Email: "ALICE@example.com"},
+		&models.LoginThrottle{Key: "account:" + alice.Email, LastFailureAt: now},
+		&models.UsernameHistory{UserID: alice.ID, Username: "alice_old"},
+		&models.Block{BlockerID: alice.ID, BlockedID: bob.ID},
+		&models.Block{BlockerID: bob.ID, BlockedID: alice.ID},
+		&models.Mute{MuterID: alice.ID, MutedID: bob.ID},
+		&models.Mute{MuterID: bob.ID, MutedID: alice.ID},
+		&models.FollowRequest{RequesterID: alice.ID, TargetID: bob.ID},
+		&models.FollowRequest{RequesterID: bob.ID, TargetID: alice.ID},
+		&models.Suggestion{UserID: alice.ID, SuggestedID: bob.ID},
+		&models.Suggestion{UserID: bob.ID, SuggestedID: alice.ID},
+		&models.Upload{UserID: alice.ID, StorageKey: "uploads/alice", ContentType: "image/png", Size: 4, ExpiresAt: now},
+		&models.MagicLink{JTI: "jti", Email: alice.Email, ExpiresAt: now},
+		&aliceMedia,
+		&bobMedia,
+	)
+
+	if err := Purge(db, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only bob, his post and its media are left.
+	for _, tt := range []struct {
+		model interface{}
+		want  int64
+	}{
+		{&models.User{}, 1},
+		{&models.Post{}, 1},
+		{&models.Media{}, 1},
+		{&models.MediaVariant{}, 0},
+		{&models.Like{}, 0},
+		{&models.Comment{}, 0},
+		{&models.ChatMessage{}, 0},
+		{&models.Follow{}, 0},
+		{&models.Project{}, 0},
+		{&models.TechnologyStack{}, 0},
+		{&models.StackItem{}, 0},
+		{&models.Feature{}, 0},
+		{&models.Prd{}, 0},
+		{&models.Session{}, 0},
+		{&models.PasswordReset{}, 0},
+		{&models.EmailVerification{}, 0},
+		{&models.RecoveryCode{}, 0},
+		{&models.OAuthIdentity{}, 0},
+		{&models.PersonalAccessToken{}, 0},
+		{&models.LoginAttempt{}, 0},
+		{&models.LoginThrottle{}, 0},
+		{&models.UsernameHistory{}, 0},
+		{&models.Block{}, 0},
+		{&models.Mute{}, 0},
+		{&models.FollowRequest{}, 0},
+		{&models.Suggestion{}, 0},
+		{&models.Upload{}, 0},
+		{&models.MagicLink{}, 0},
+	} {
+		var n int64
+		if err := db.Unscoped().Model(tt.model).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.want {
+			t.Errorf("%T rows = %d, want %d", tt.model, n, tt.want)
+		}
+	}
+
+	var post models.Post
+	if err := db.First(&post, bobPost.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.LikeCount != 0 || post.CommentsCount != 0 {
+		t.Errorf("bob's post counts = %d likes, %d comments, want none", post.LikeCount, post.CommentsCount)
+	}
+	if err := db.First(&bob, bob.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bob.FollowerCount != 0 || bob.FollowingCount != 0 {
+		t.Errorf("bob's follow counts = %d followers, %d following, want none", bob.FollowerCount, bob.FollowingCount)
+	}
+
+	for key, want := range map[string]bool{
+		"media/alice":       false,
+		"media/alice-small": false,
+		"uploads/alice":     false,
+		"avatars/alice":     false,
+		"media/bob":         true,
+	} {
+		if got := stored(backend, key); got != want {
+			t.Errorf("%s stored = %v, want %v", key, got, want)
+		}
+	}
+}
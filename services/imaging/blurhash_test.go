@@ -0,0 +1,36 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBlurhash(t *testing.T) {
+	// An 8×6 gradient. The expected hash comes from a separate port of the
+	// reference encoder.
+	gradient := func(img *image.RGBA, x0, y0 int) {
+		for y := 0; y < 6; y++ {
+			for x := 0; x < 8; x++ {
+				img.Set(x0+x, y0+y, color.RGBA{uint8(x * 32), uint8(y * 48), uint8(255 - x*20 - y*16), 255})
+			}
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	gradient(img, 0, 0)
+
+	const want = "LwF?Y17jb2xvu}RrfTnUeufAfRf9"
+	if got := Blurhash(img); got != want {
+		t.Errorf("Blurhash() = %q, want %q", got, want)
+	}
+
+	// Only the pixels within the bounds count, wherever they start.
+	framed := image.NewRGBA(image.Rect(0, 0, 12, 10))
+	gradient(framed, 2, 3)
+	if got := Blurhash(framed.SubImage(image.Rect(2, 3, 10, 9))); got != want {
+		t.Errorf("Blurhash() of a sub-image = %q, want %q", got, want)
+	}
+	if got := Blurhash(image.NewRGBA(image.Rect(0, 0, 0, 0))); got != "" {
+		t.Errorf("Blurhash() of an empty image = %q, want empty", got)
+	}
+}
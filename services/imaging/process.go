@@ -0,0 +1,209 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailSizes lists the thumbnails Process generates, by name, with the
+// length of their longest side in pixels.
+var ThumbnailSizes = []struct {
+	Name string
+	Size int
+}{
+	{"small", 320},
+	{"medium", 640},
+	{"large", 1280},
+}
+
+// maxGIFFrames caps the frames of an animated GIF, however small they are.
+const maxGIFFrames = 1000
+
+// blurhashSize is the longest side of the copy a blurhash is computed from.
+// The hash only keeps a handful of components, so more pixels add nothing.
+const blurhashSize = 32
+
+// Variant is an encoded rendition of an uploaded image.
+type Variant struct {
+	Name        string
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Processed is the result of Process.
+type Processed struct {
+	Original   Variant
+	Thumbnails []Variant
+	Blurhash   string
+}
+
+// Process decodes an uploaded image and prepares it for storage. The
+// original is re-encoded upright, which drops EXIF and any other metadata;
+// JPEGs stay JPEGs and other formats become PNGs, except opaque WebPs,
+// which become JPEGs since we cannot write WebP. Animated GIFs keep all
+// their frames so they still play; they are re-encoded too, which drops
+// comments and application extensions such as XMP. An animation with more
+// than maxGIFFrames frames, or whose frames would take more than MaxPixels
+// at the size of its canvas, is rejected with ErrTooLarge. Thumbnails are only
+// generated for sizes smaller than the original, so a small image may have
+// none.
+func Process(r io.Reader) (*Processed, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	asJPEG := format == "jpeg" || (format == "webp" && opaque(img))
+	b := img.Bounds()
+	result := &Processed{}
+	result.Original = Variant{Name: "original", Width: b.Dx(), Height: b.Dy()}
+	anim, err := animatedGIF(format, data)
+	if err != nil {
+		return nil, err
+	}
+	if anim != nil {
+		var out bytes.Buffer
+		if err := gif.EncodeAll(&out, anim); err != nil {
+			return nil, err
+		}
+		result.Original.Data, result.Original.ContentType = out.Bytes(), "image/gif"
+	} else {
+		result.Original.Data, result.Original.ContentType, err = encode(img, asJPEG, 90)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, size := range ThumbnailSizes {
+		if b.Dx() <= size.Size && b.Dy() <= size.Size {
+			continue
+		}
+		thumb := resize(img, size.Size)
+		v := Variant{Name: size.Name, Width: thumb.Bounds().Dx(), Height: thumb.Bounds().Dy()}
+		v.Data, v.ContentType, err = encode(thumb, asJPEG, 85)
+		if err != nil {
+			return nil, err
+		}
+		result.Thumbnails = append(result.Thumbnails, v)
+	}
+
+	result.Blurhash = Blurhash(resize(img, blurhashSize))
+	return result, nil
+}
+
+// resize scales img so its longest side is size pixels, keeping its aspect
+// ratio. Images already that small are returned unchanged.
+func resize(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// opaque reports whether every pixel of img is fully opaque.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// animatedGIF decodes every frame of a GIF that has more than one, and
+// returns nil for anything else. The frames are counted first, so that
+// ErrTooLarge is returned before decoding too many of them.
+func animatedGIF(format string, data []byte) (*gif.GIF, error) {
+	if format != "gif" {
+		return nil, nil
+	}
+	frames, width, height := gifFrames(data)
+	if frames < 2 {
+		return nil, nil
+	}
+	if frames > maxGIFFrames || frames*width*height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(g.Image) < 2 {
+		return nil, nil
+	}
+	return g, nil
+}
+
+// gifFrames walks the blocks of a GIF without decoding any pixels and
+// returns the size of its canvas and how many frames it has, counting no
+// further than one past maxGIFFrames. A GIF it cannot make sense of has no
+// frames.
+func gifFrames(data []byte) (frames, width, height int) {
+	if len(data) < 13 {
+		return 0, 0, 0
+	}
+	width = int(binary.LittleEndian.Uint16(data[6:]))
+	height = int(binary.LittleEndian.Uint16(data[8:]))
+	i := 13
+	if data[10]&0x80 != 0 { // global color table
+		i += 3 << (data[10]&7 + 1)
+	}
+	// skipSubBlocks moves i past a run of data sub-blocks, reporting
+	// whether it ended before the data did.
+	skipSubBlocks := func() bool {
+		for i < len(data) {
+			n := int(data[i])
+			i += 1 + n
+			if n == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension: a label, then sub-blocks
+			i += 2
+			if !skipSubBlocks() {
+				return 0, 0, 0
+			}
+		case 0x2C: // image descriptor, then LZW-compressed sub-blocks
+			if i+10 > len(data) {
+				return 0, 0, 0
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 { // local color table
+				i += 3 << (flags&7 + 1)
+			}
+			i++ // LZW minimum code size
+			if !skipSubBlocks() {
+				return 0, 0, 0
+			}
+			frames++
+			if frames > maxGIFFrames {
+				return frames, width, height
+			}
+		case 0x3B: // trailer
+			return frames, width, height
+		default:
+			return 0, 0, 0
+		}
+	}
+	return 0, 0, 0
+}
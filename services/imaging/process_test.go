@@ -0,0 +1,314 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// blockSize is the side of each coloured block in the test images, large
+// enough for JPEG artefacts to stay clear of block centres.
+const blockSize = 16
+
+// upright is a 3×2 grid of distinct colours, as it should be displayed.
+// No rotation or mirroring of it looks the same.
+var upright = [][]color.RGBA{
+	{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}},
+	{{255, 255, 0, 255}, {0, 255, 255, 255}, {255, 0, 255, 255}},
+}
+
+// stored lays out upright the way a camera stores it for an EXIF
+// orientation, following the definitions of where the stored image's first
+// row and column belong when displayed.
+func stored(orientation int) [][]color.RGBA {
+	h, w := len(upright), len(upright[0])
+	at := func(x, y int) color.RGBA { return upright[y][x] }
+	sw, sh := w, h
+	if orientation >= 5 {
+		sw, sh = h, w
+	}
+	grid := make([][]color.RGBA, sh)
+	for y := range grid {
+		grid[y] = make([]color.RGBA, sw)
+		for x := range grid[y] {
+			switch orientation {
+			case 1: // row 0 top, column 0 left
+				grid[y][x] = at(x, y)
+			case 2: // top, right
+				grid[y][x] = at(w-1-x, y)
+			case 3: // bottom, right
+				grid[y][x] = at(w-1-x, h-1-y)
+			case 4: // bottom, left
+				grid[y][x] = at(x, h-1-y)
+			case 5: // left, top
+				grid[y][x] = at(y, x)
+			case 6: // right, top
+				grid[y][x] = at(w-1-y, x)
+			case 7: // right, bottom
+				grid[y][x] = at(w-1-y, h-1-x)
+			case 8: // left, bottom
+				grid[y][x] = at(y, h-1-x)
+			}
+		}
+	}
+	return grid
+}
+
+func render(grid [][]color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(grid[0])*blockSize, len(grid)*blockSize))
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			img.SetRGBA(x, y, grid[y/blockSize][x/blockSize])
+		}
+	}
+	return img
+}
+
+// exifSegment builds an APP1 segment holding an orientation tag and an
+// image description.
+func exifSegment(orientation int, description string) []byte {
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	tiff.WriteString("II")
+	binary.Write(&tiff, le, uint16(42))
+	binary.Write(&tiff, le, uint32(8))
+	binary.Write(&tiff, le, uint16(2))
+	// Orientation, SHORT.
+	binary.Write(&tiff, le, []uint16{0x0112, 3})
+	binary.Write(&tiff, le, uint32(1))
+	binary.Write(&tiff, le, []uint16{uint16(orientation), 0})
+	// ImageDescription, ASCII, stored after the IFD.
+	desc := append([]byte(description), 0)
+	binary.Write(&tiff, le, []uint16{0x010E, 2})
+	binary.Write(&tiff, le, uint32(len(desc)))
+	binary.Write(&tiff, le, uint32(8+2+2*12+4))
+	binary.Write(&tiff, le, uint32(0))
+	tiff.Write(desc)
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	return segment(0xE1, payload)
+}
+
+func segment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// jpegWithMetadata encodes img as a JPEG carrying EXIF and a comment.
+func jpegWithMetadata(t *testing.T, img image.Image, orientation int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(out, exifSegment(orientation, "GPSSECRET 52.37N 4.89E")...)
+	out = append(out, segment(0xFE, []byte("COMMENTSECRET"))...)
+	return append(out, data[2:]...)
+}
+
+func near(a, b color.Color) bool {
+	r1, g1, b1, _ := a.RGBA()
+	r2, g2, b2, _ := b.RGBA()
+	diff := func(x, y uint32) bool { return x>>8 > y>>8+48 || y>>8 > x>>8+48 }
+	return !diff(r1, r2) && !diff(g1, g2) && !diff(b1, b2)
+}
+
+func decodeVariant(t *testing.T, v Variant) image.Image {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(v.Data))
+	if err != nil {
+		t.Fatalf("decoding %s: %v", v.Name, err)
+	}
+	return img
+}
+
+func TestProcessOrientation(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		data := jpegWithMetadata(t, render(stored(orientation)), orientation)
+		if got := jpegOrientation(data); got != orientation {
+			t.Errorf("orientation %d: jpegOrientation() = %d", orientation, got)
+		}
+
+		p, err := Process(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("orientation %d: Process() error = %v", orientation, err)
+		}
+		wantW, wantH := len(upright[0])*blockSize, len(upright)*blockSize
+		if p.Original.Width != wantW || p.Original.Height != wantH {
+			t.Errorf("orientation %d: size = %d×%d, want %d×%d", orientation, p.Original.Width, p.Original.Height, wantW, wantH)
+			continue
+		}
+		img := decodeVariant(t, p.Original)
+		for y, row := range upright {
+			for x, want := range row {
+				got := img.At(x*blockSize+blockSize/2, y*blockSize+blockSize/2)
+				if !near(got, want) {
+					t.Errorf("orientation %d: block (%d, %d) = %v, want %v", orientation, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// jpegMarkers lists the markers of the segments before a JPEG's image data.
+func jpegMarkers(data []byte) []byte {
+	var markers []byte
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		markers = append(markers, data[i+1])
+		if data[i+1] == 0xDA {
+			break
+		}
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+	}
+	return markers
+}
+
+func TestProcessStripsJPEGMetadata(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 800, 500))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7)
+	}
+	p, err := Process(bytes.NewReader(jpegWithMetadata(t, src, 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Thumbnails) != 2 {
+		t.Fatalf("thumbnails = %d, want small and medium", len(p.Thumbnails))
+	}
+	for _, v := range append([]Variant{p.Original}, p.Thumbnails...) {
+		if v.ContentType != "image/jpeg" {
+			t.Errorf("%s: content type = %s", v.Name, v.ContentType)
+		}
+		if bytes.Contains(v.Data, []byte("SECRET")) || bytes.Contains(v.Data, []byte("Exif")) {
+			t.Errorf("%s still carries metadata", v.Name)
+		}
+		for _, m := range jpegMarkers(v.Data) {
+			if m == 0xE1 || m == 0xFE {
+				t.Errorf("%s has a %#x segment", v.Name, m)
+			}
+		}
+	}
+}
+
+func TestProcessStripsPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, render(upright)); err != nil {
+		t.Fatal(err)
+	}
+	// Add a tEXt chunk before IEND.
+	data := buf.Bytes()
+	iend := len(data) - 12
+	text := []byte("tEXtComment\x00PNGSECRET")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+	withText := append(append(append([]byte{}, data[:iend]...), chunk...), data[iend:]...)
+
+	p, err := Process(bytes.NewReader(withText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Original.ContentType != "image/png" {
+		t.Errorf("content type = %s, want image/png", p.Original.ContentType)
+	}
+	if bytes.Contains(p.Original.Data, []byte("PNGSECRET")) {
+		t.Error("tEXt chunk kept")
+	}
+}
+
+func TestProcessAnimatedGIF(t *testing.T) {
+	anim := &gif.GIF{LoopCount: 0}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 20, 10), palette.Plan9)
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8(i * 40)
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10*(i+1))
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a comment and an XMP application extension before the trailer.
+	data := buf.Bytes()
+	var ext bytes.Buffer
+	ext.Write([]byte{0x21, 0xFE, 13})
+	ext.WriteString("COMMENTSECRET")
+	ext.WriteByte(0)
+	ext.Write([]byte{0x21, 0xFF, 11})
+	ext.WriteString("XMP DataXMP")
+	ext.WriteByte(9)
+	ext.WriteString("XMPSECRET")
+	ext.WriteByte(0)
+	withExt := append(append(append([]byte{}, data[:len(data)-1]...), ext.Bytes()...), data[len(data)-1])
+	if _, err := gif.DecodeAll(bytes.NewReader(withExt)); err != nil {
+		t.Fatalf("test GIF does not decode: %v", err)
+	}
+
+	p, err := Process(bytes.NewReader(withExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Original.ContentType != "image/gif" {
+		t.Fatalf("content type = %s, want image/gif", p.Original.ContentType)
+	}
+	if bytes.Contains(p.Original.Data, []byte("SECRET")) {
+		t.Error("GIF extensions kept")
+	}
+	got, err := gif.DecodeAll(bytes.NewReader(p.Original.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Image) != 3 || got.LoopCount != 0 || got.Delay[2] != 30 {
+		t.Errorf("frames = %d, loop count = %d, delays = %v", len(got.Image), got.LoopCount, got.Delay)
+	}
+}
+
+// tinyAnimation encodes an animation of frames 1x1 frames on a width x height canvas.
+func tinyAnimation(t *testing.T, frames, width, height int) []byte {
+	t.Helper()
+	anim := &gif.GIF{Config: image.Config{Width: width, Height: height, ColorModel: color.Palette(palette.Plan9)}}
+	for i := 0; i < frames; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), palette.Plan9))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessAnimatedGIFLimits(t *testing.T) {
+	tests := []struct {
+		name                  string
+		frames, width, height int
+		wantErr               error
+	}{
+		{"within limits", 10, 2000, 2000, nil},
+		{"too many pixels", 11, 2000, 2000, ErrTooLarge},
+		{"at the frame cap", maxGIFFrames, 2, 2, nil},
+		{"too many frames", maxGIFFrames + 1, 1, 1, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		if frames, _, _ := gifFrames(tinyAnimation(t, tt.frames, tt.width, tt.height)); frames != tt.frames {
+			t.Errorf("%s: gifFrames() = %d, want %d", tt.name, frames, tt.frames)
+		}
+		_, err := Process(bytes.NewReader(tinyAnimation(t, tt.frames, tt.width, tt.height)))
+		if err != tt.wantErr {
+			t.Errorf("%s: Process() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package imaging decodes, crops and re-encodes uploaded images.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	// Register the decoders for formats we accept but do not write.
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels bounds the dimensions of images we are willing to decode, so a
+// small file cannot expand into an enormous bitmap.
+const MaxPixels = 40_000_000
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+// decode decodes data after checking its dimensions against MaxPixels and
+// turns JPEGs upright according to their EXIF orientation. It returns the
+// image and the name of its format.
+func decode(data []byte) (image.Image, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, format, nil
+}
+
+// encode writes img as a JPEG if asJPEG is set and as a PNG otherwise,
+// returning the encoded image and its content type.
+func encode(img image.Image, asJPEG bool, quality int) ([]byte, string, error) {
+	var out bytes.Buffer
+	if asJPEG {
+		err := jpeg.Encode(&out, img, &jpeg.Options{Quality: quality})
+		return out.Bytes(), "image/jpeg", err
+	}
+	err := png.Encode(&out, img)
+	return out.Bytes(), "image/png", err
+}
+
+// Square decodes an image, crops it to a centred square and scales it to
+// size×size pixels. JPEGs stay JPEGs; everything else becomes a PNG so
+// transparency survives. It returns the encoded image and its content type.
+// Re-encoding also drops any metadata the original carried.
+func Square(r io.Reader, size int) ([]byte, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	src, format, err := decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Crop the largest centred square.
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	if side < size {
+		size = side
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+	return encode(dst, format == "jpeg", 90)
+}
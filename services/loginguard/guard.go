@@ -0,0 +1,212 @@
+// Package loginguard throttles password guessing. Failures are counted per
+// account and per client IP; after a few failures each further attempt must
+// wait exponentially longer, and too many failures lock the key out for a
+// while.
+package loginguard
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"socialmedia/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Failure reasons recorded in the audit log.
+const (
+	ReasonInvalidCredentials = "invalid_credentials"
+	ReasonInvalidCode        = "invalid_2fa_code"
+	ReasonThrottled          = "throttled"
+)
+
+// Clock tells the guard the current time. Tests can swap in a fake.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the real wall clock.
+var SystemClock Clock = systemClock{}
+
+type Config struct {
+	// FreeAttempts failures per account (IPFreeAttempts per IP, which may
+	// be shared behind NAT) are allowed before backoff starts. Each further
+	// failure doubles the wait, starting at BaseDelay and capped at MaxDelay.
+	FreeAttempts   int
+	IPFreeAttempts int
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+
+	// After MaxFailures failures for one account (or IPMaxFailures from one
+	// IP) within Window, the key is locked for LockoutDuration.
+	MaxFailures     int
+	IPMaxFailures   int
+	Window          time.Duration
+	LockoutDuration time.Duration
+
+	Clock Clock
+}
+
+// DefaultConfig returns the settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		FreeAttempts:    3,
+		IPFreeAttempts:  10,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		MaxFailures:     5,
+		IPMaxFailures:   50,
+		Window:          15 * time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		Clock:           SystemClock,
+	}
+}
+
+// Attempt describes one login attempt.
+type Attempt struct {
+	Email     string
+	IP        string
+	UserAgent string
+	UserID    *uint
+}
+
+type Guard struct {
+	db  *gorm.DB
+	cfg Config
+}
+
+func New(db *gorm.DB, cfg Config) *Guard {
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+	return &Guard{db: db, cfg: cfg}
+}
+
+// Check returns how long the client must wait before it may attempt to log
+// in as the attempt's account; zero means the attempt may go ahead. Blocked
+// attempts are recorded in the audit log.
+func (g *Guard) Check(a Attempt) (time.Duration, error) {
+	wait, err := g.wait(a)
+	if err != nil || wait == 0 {
+		return wait, err
+	}
+	return wait, g.audit(a, ReasonThrottled)
+}
+
+// Fail records a failed attempt and returns how long the client must now
+// wait before trying again.
+func (g *Guard) Fail(a Attempt, reason string) (time.Duration, error) {
+	if err := g.audit(a, reason); err != nil {
+		return 0, err
+	}
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if err := g.recordFailure(tx, accountKey(a.Email), g.cfg.MaxFailures); err != nil {
+			return err
+		}
+		return g.recordFailure(tx, ipKey(a.IP), g.cfg.IPMaxFailures)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return g.wait(a)
+}
+
+// Succeed clears the account's failure count after a successful login. The
+// IP's count is left to expire so one valid account can't be used to reset
+// an attacker's budget.
+func (g *Guard) Succeed(email string) error {
+	return g.db.Where(map[string]interface{}{"key": accountKey(email)}).Delete(&models.LoginThrottle{}).Error
+}
+
+func (g *Guard) wait(a Attempt) (time.Duration, error) {
+	var throttles []models.LoginThrottle
+	if err := g.db.Where(map[string]interface{}{"key": []string{accountKey(a.Email), ipKey(a.IP)}}).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+	now := g.cfg.Clock.Now()
+	var wait time.Duration
+	for _, t := range throttles {
+		free := g.cfg.FreeAttempts
+		if strings.HasPrefix(t.Key, "ip:") {
+			free = g.cfg.IPFreeAttempts
+		}
+		if w := g.waitFor(t, now, free); w > wait {
+			wait = w
+		}
+	}
+	return wait, nil
+}
+
+// waitFor computes the remaining wait imposed by one throttle record.
+func (g *Guard) waitFor(t models.LoginThrottle, now time.Time, free int) time.Duration {
+	if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+		return t.LockedUntil.Sub(now)
+	}
+	if now.Sub(t.LastFailureAt) > g.cfg.Window || t.Failures <= free {
+		return 0
+	}
+	if wait := t.LastFailureAt.Add(g.backoff(t.Failures - free)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// backoff is the delay imposed after the given number of failures beyond
+// the free allowance.
+func (g *Guard) backoff(excess int) time.Duration {
+	delay := g.cfg.BaseDelay
+	for i := 1; i < excess; i++ {
+		delay *= 2
+		if delay >= g.cfg.MaxDelay {
+			return g.cfg.MaxDelay
+		}
+	}
+	return delay
+}
+
+func (g *Guard) recordFailure(tx *gorm.DB, key string, maxFailures int) error {
+	now := g.cfg.Clock.Now()
+
+	t := models.LoginThrottle{Key: key}
+	err := tx.Where(map[string]interface{}{"key": key}).First(&t).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if now.Sub(t.LastFailureAt) > g.cfg.Window {
+		t.Failures = 0
+	}
+	t.Failures++
+	t.LastFailureAt = now
+	if maxFailures > 0 && t.Failures >= maxFailures {
+		lockedUntil := now.Add(g.cfg.LockoutDuration)
+		t.LockedUntil = &lockedUntil
+		t.Failures = 0
+	}
+
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&t).Error
+}
+
+func (g *Guard) audit(a Attempt, reason string) error {
+	return g.db.Create(&models.LoginAttempt{
+		Email:     normalizeEmail(a.Email),
+		UserID:    a.UserID,
+		IP:        a.IP,
+		UserAgent: a.UserAgent,
+		Reason:    reason,
+		CreatedAt: g.cfg.Clock.Now(),
+	}).Error
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func accountKey(email string) string { return "account:" + normalizeEmail(email) }
+
+func ipKey(ip string) string { return "ip:" + ip }
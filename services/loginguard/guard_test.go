@@ -0,0 +1,174 @@
+package loginguard
+
+import (
+	"testing"
+	"time"
+
+	"socialmedia/internal/testutil"
+	"socialmedia/models"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestGuard(t *testing.T, configure func(*Config)) (*Guard, *fakeClock) {
+	t.Helper()
+	db := testutil.NewDB(t)
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	cfg := DefaultConfig()
+	cfg.Clock = clock
+	if configure != nil {
+		configure(&cfg)
+	}
+	return New(db, cfg), clock
+}
+
+func mustFail(t *testing.T, g *Guard, a Attempt) time.Duration {
+	t.Helper()
+	wait, err := g.Fail(a, ReasonInvalidCredentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wait
+}
+
+func mustCheck(t *testing.T, g *Guard, a Attempt) time.Duration {
+	t.Helper()
+	wait, err := g.Check(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wait
+}
+
+func TestBackoff(t *testing.T) {
+	g, clock := newTestGuard(t, func(cfg *Config) {
+		cfg.MaxFailures = 0
+		cfg.MaxDelay = 4 * time.Second
+	})
+	a := Attempt{Email: "user@example.com", IP: "192.0.2.1"}
+
+	for i := 1; i <= 3; i++ {
+		if wait := mustFail(t, g, a); wait != 0 {
+			t.Fatalf("failure %d: wait = %v, want none within the free attempts", i, wait)
+		}
+	}
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if wait := mustFail(t, g, a); wait != want {
+			t.Fatalf("wait = %v, want %v", wait, want)
+		}
+		if wait := mustCheck(t, g, a); wait != want {
+			t.Fatalf("Check() = %v, want %v", wait, want)
+		}
+		clock.Advance(want - time.Millisecond)
+		if wait := mustCheck(t, g, a); wait != time.Millisecond {
+			t.Fatalf("Check() just before the backoff ends = %v", wait)
+		}
+		clock.Advance(time.Millisecond)
+		if wait := mustCheck(t, g, a); wait != 0 {
+			t.Fatalf("Check() after the backoff = %v, want 0", wait)
+		}
+	}
+
+	// Failures older than the window are forgotten.
+	clock.Advance(DefaultConfig().Window + time.Second)
+	if wait := mustFail(t, g, a); wait != 0 {
+		t.Errorf("wait after the window = %v, want 0", wait)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	g, clock := newTestGuard(t, func(cfg *Config) { cfg.BaseDelay = 0 })
+	a := Attempt{Email: "user@example.com", IP: "192.0.2.1"}
+
+	for i := 1; i < g.cfg.MaxFailures; i++ {
+		mustFail(t, g, a)
+	}
+	if wait := mustFail(t, g, a); wait != g.cfg.LockoutDuration {
+		t.Fatalf("wait after %d failures = %v, want lockout %v", g.cfg.MaxFailures, wait, g.cfg.LockoutDuration)
+	}
+
+	// The lockout applies to the account from any IP, and is audited.
+	other := Attempt{Email: " USER@example.com ", IP: "198.51.100.7"}
+	if wait := mustCheck(t, g, other); wait != g.cfg.LockoutDuration {
+		t.Errorf("Check() from another IP = %v, want %v", wait, g.cfg.LockoutDuration)
+	}
+	var throttled int64
+	g.db.Model(&models.LoginAttempt{}).Where("reason = ?", ReasonThrottled).Count(&throttled)
+	if throttled != 1 {
+		t.Errorf("throttled attempts logged = %d, want 1", throttled)
+	}
+
+	clock.Advance(g.cfg.LockoutDuration)
+	if wait := mustCheck(t, g, a); wait != 0 {
+		t.Errorf("Check() after the lockout = %v, want 0", wait)
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	g, _ := newTestGuard(t, func(cfg *Config) {
+		cfg.BaseDelay = 0
+		cfg.IPMaxFailures = 4
+	})
+
+	// Spreading guesses over accounts still locks the IP out.
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		mustFail(t, g, Attempt{Email: email, IP: "192.0.2.1"})
+	}
+	if wait := mustFail(t, g, Attempt{Email: "d@example.com", IP: "192.0.2.1"}); wait != g.cfg.LockoutDuration {
+		t.Fatalf("wait = %v, want lockout %v", wait, g.cfg.LockoutDuration)
+	}
+	if wait := mustCheck(t, g, Attempt{Email: "e@example.com", IP: "192.0.2.1"}); wait == 0 {
+		t.Error("locked IP may try another account")
+	}
+	if wait := mustCheck(t, g, Attempt{Email: "e@example.com", IP: "192.0.2.2"}); wait != 0 {
+		t.Errorf("another IP must wait %v", wait)
+	}
+}
+
+func TestSucceedResetsAccount(t *testing.T) {
+	g, _ := newTestGuard(t, func(cfg *Config) { cfg.IPFreeAttempts = 3 })
+	a := Attempt{Email: "user@example.com", IP: "192.0.2.1"}
+
+	for i := 0; i < 4; i++ {
+		mustFail(t, g, a)
+	}
+	if err := g.Succeed("User@Example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The account count is cleared but the IP's is not, so a valid login
+	// can't be used to reset an attacker's budget.
+	if wait := mustCheck(t, g, Attempt{Email: a.Email, IP: "192.0.2.2"}); wait != 0 {
+		t.Errorf("account still throttled for %v after a successful login", wait)
+	}
+	if wait := mustCheck(t, g, a); wait == 0 {
+		t.Error("IP throttle was cleared by a successful login")
+	}
+}
+
+// A correct password followed by a wrong two-factor code is a failed login:
+// the code failures must accumulate until the account locks.
+func TestPasswordThenWrongCode(t *testing.T) {
+	g, _ := newTestGuard(t, func(cfg *Config) { cfg.BaseDelay = 0 })
+	a := Attempt{Email: "user@example.com", IP: "192.0.2.1"}
+
+	for i := 1; i <= g.cfg.MaxFailures; i++ {
+		// Password accepted: the guard is only checked, not reset, until
+		// the code is verified.
+		if wait := mustCheck(t, g, a); wait != 0 {
+			t.Fatalf("attempt %d: locked out early for %v", i, wait)
+		}
+		if _, err := g.Fail(a, ReasonInvalidCode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if wait := mustCheck(t, g, a); wait != g.cfg.LockoutDuration {
+		t.Errorf("Check() = %v, want lockout %v", wait, g.cfg.LockoutDuration)
+	}
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"socialmedia/models"
+	"strings"
+)
+
+// DetermineMediaType maps a sniffed content type to the kind of media it
+// holds. ok is false for anything that is not an image or video.
+func DetermineMediaType(mimeType string) (mediaType models.MediaType, ok bool) {
+	switch {
+	case strings.HasPrefix(mimeType, "image/gif"):
+		return models.GifType, true
+	case strings.HasPrefix(mimeType, "image/"):
+		return models.ImageType, true
+	case strings.HasPrefix(mimeType, "video/"):
+		return models.VideoType, true
+	default:
+		return "", false
+	}
+}
+
+// IsAttachable reports whether files of the given content type can be
+// attached to posts.
+func IsAttachable(mimeType string) bool {
+	_, ok := DetermineMediaType(mimeType)
+	return ok
+}
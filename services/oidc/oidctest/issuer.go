@@ -0,0 +1,151 @@
+// Package oidctest provides an in-process OpenID Connect provider for tests.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// KeyID is the key ID the issuer signs ID tokens with.
+const KeyID = "test-key"
+
+// Issuer is a fake identity provider serving discovery, a JWKS and a token
+// endpoint. Tests register the ID token an authorization code exchanges for
+// with Code.
+type Issuer struct {
+	Server   *httptest.Server
+	URL      string
+	ClientID string
+	Key      *rsa.PrivateKey
+
+	mutex sync.Mutex
+	codes map[string]string
+	next  int
+}
+
+// NewIssuer starts an issuer for the given client. It is closed when the
+// test ends.
+func NewIssuer(t testing.TB, clientID string) *Issuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &Issuer{ClientID: clientID, Key: key, codes: make(map[string]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/jwks", i.jwks)
+	mux.HandleFunc("/token", i.token)
+	i.Server = httptest.NewServer(mux)
+	i.URL = i.Server.URL
+	t.Cleanup(i.Server.Close)
+	return i
+}
+
+// Claims returns valid ID token claims for subject with the given nonce,
+// for tests to adjust before signing.
+func (i *Issuer) Claims(subject, email, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            i.URL,
+		"aud":            i.ClientID,
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+		"name":           "Test User",
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+// Sign signs claims as an ID token with the issuer's key.
+func (i *Issuer) Sign(claims jwt.MapClaims) string {
+	return SignWith(i.Key, claims)
+}
+
+// SignWith signs claims as an ID token with key under KeyID, e.g. to forge a
+// token the issuer did not sign.
+func SignWith(key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// Code registers an authorization code that the token endpoint exchanges
+// for an ID token with claims, and returns it.
+func (i *Issuer) Code(claims jwt.MapClaims) string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.next++
+	code := "code-" + strconv.Itoa(i.next)
+	i.codes[code] = i.Sign(claims)
+	return code
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := i.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// token exchanges a registered code once, as a real provider would.
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	i.mutex.Lock()
+	idToken, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mutex.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
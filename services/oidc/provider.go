@@ -0,0 +1,238 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"socialmedia/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+)
+
+// discoveryDocument is the subset of the OpenID Provider metadata we use.
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the identity claims we read from an ID token or the userinfo
+// endpoint.
+type Claims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+// idTokenClaims decodes an ID token. email_verified is sometimes sent as the
+// string "true", so it is decoded loosely.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string      `json:"nonce"`
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+	Picture       string      `json:"picture"`
+}
+
+// Provider is an OpenID Connect identity provider.
+type Provider struct {
+	Name   string
+	config config.OIDCProvider
+	client *http.Client
+
+	mutex     sync.Mutex
+	discovery *discoveryDocument
+	keys      *keySet
+}
+
+func NewProvider(cfg config.OIDCProvider) *Provider {
+	return &Provider{
+		Name:   cfg.Name,
+		config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// metadata returns the provider's discovery document, fetching it on first use.
+func (p *Provider) metadata(ctx context.Context) (*discoveryDocument, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc discoveryDocument
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", "", &doc); err != nil {
+		return nil, fmt.Errorf("discovery for %s failed: %w", p.Name, err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("discovery for %s returned issuer %q", p.Name, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery for %s is missing required endpoints", p.Name)
+	}
+
+	p.discovery = &doc
+	p.keys = newKeySet(doc.JWKSURI, p.getJSON)
+	return p.discovery, nil
+}
+
+func (p *Provider) oauth2Config(doc *discoveryDocument) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       p.config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  doc.AuthorizationEndpoint,
+			TokenURL: doc.TokenEndpoint,
+		},
+	}
+}
+
+// AuthCodeURL builds the authorization URL for the given state, nonce and
+// PKCE S256 code challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2Config(doc).AuthCodeURL(state,
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// Authenticate exchanges an authorization code, verifies the returned ID
+// token against the provider's keys and the expected nonce, and returns the
+// user's identity claims.
+func (p *Provider) Authenticate(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth2Config(doc).Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response did not include an id_token")
+	}
+	claims, err := p.VerifyIDToken(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some providers only return profile claims from the userinfo endpoint.
+	if claims.Email == "" && doc.UserinfoEndpoint != "" {
+		var info Claims
+		if err := p.getJSON(ctx, doc.UserinfoEndpoint, token.AccessToken, &info); err != nil {
+			return nil, fmt.Errorf("userinfo request failed: %w", err)
+		}
+		if info.Subject != claims.Subject {
+			return nil, errors.New("userinfo subject does not match id_token")
+		}
+		claims.Email = info.Email
+		claims.EmailVerified = info.EmailVerified
+		if claims.Name == "" {
+			claims.Name = info.Name
+		}
+		if claims.Picture == "" {
+			claims.Picture = info.Picture
+		}
+	}
+
+	if claims.Email == "" {
+		return nil, errors.New("identity provider did not return an email address")
+	}
+	return claims, nil
+}
+
+// VerifyIDToken checks an ID token's signature, issuer, audience, expiry and
+// nonce and returns its identity claims.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*Claims, error) {
+	if _, err := p.metadata(ctx); err != nil {
+		return nil, err
+	}
+
+	parser := jwt.NewParser(jwt.WithValidMethods(supportedAlgorithms))
+	var claims idTokenClaims
+	_, err := parser.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != p.config.Issuer {
+		return nil, errors.New("id_token has an unexpected issuer")
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, errors.New("id_token was not issued for this client")
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("id_token has no expiry")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+
+	verified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+
+	return &Claims{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}, nil
+}
+
+// getJSON fetches url and decodes the JSON response into v, optionally with
+// a bearer token.
+func (p *Provider) getJSON(ctx context.Context, url, bearer string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
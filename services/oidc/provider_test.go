@@ -0,0 +1,158 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"socialmedia/config"
+	"socialmedia/services/oidc/oidctest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Issuer) {
+	t.Helper()
+	issuer := oidctest.NewIssuer(t, "client-id")
+	return NewProvider(config.OIDCProvider{
+		Name:        "test",
+		Issuer:      issuer.URL,
+		ClientID:    issuer.ClientID,
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"openid", "email"},
+	}), issuer
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		nonce   string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			token: func() string { return issuer.Sign(issuer.Claims("sub-1", "a@example.com", "nonce")) },
+			nonce: "nonce",
+		},
+		{
+			name:    "nonce mismatch",
+			token:   func() string { return issuer.Sign(issuer.Claims("sub-1", "a@example.com", "other")) },
+			nonce:   "nonce",
+			wantErr: "nonce mismatch",
+		},
+		{
+			name:    "missing expected nonce",
+			token:   func() string { return issuer.Sign(issuer.Claims("sub-1", "a@example.com", "")) },
+			nonce:   "",
+			wantErr: "nonce mismatch",
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				claims := issuer.Claims("sub-1", "a@example.com", "nonce")
+				claims["aud"] = "another-client"
+				return issuer.Sign(claims)
+			},
+			nonce:   "nonce",
+			wantErr: "not issued for this client",
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				claims := issuer.Claims("sub-1", "a@example.com", "nonce")
+				claims["iss"] = "https://evil.example.com"
+				return issuer.Sign(claims)
+			},
+			nonce:   "nonce",
+			wantErr: "unexpected issuer",
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := issuer.Claims("sub-1", "a@example.com", "nonce")
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+				return issuer.Sign(claims)
+			},
+			nonce:   "nonce",
+			wantErr: "expired",
+		},
+		{
+			name: "no expiry",
+			token: func() string {
+				claims := issuer.Claims("sub-1", "a@example.com", "nonce")
+				delete(claims, "exp")
+				return issuer.Sign(claims)
+			},
+			nonce:   "nonce",
+			wantErr: "no expiry",
+		},
+		{
+			name:    "forged signature",
+			token:   func() string { return oidctest.SignWith(otherKey, issuer.Claims("sub-1", "a@example.com", "nonce")) },
+			nonce:   "nonce",
+			wantErr: "invalid id_token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := provider.VerifyIDToken(context.Background(), tt.token(), tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyIDToken() error = %v", err)
+				}
+				if claims.Subject != "sub-1" || claims.Email != "a@example.com" || !claims.EmailVerified {
+					t.Errorf("VerifyIDToken() = %+v", claims)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("VerifyIDToken() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	ctx := context.Background()
+
+	code := issuer.Code(issuer.Claims("sub-1", "a@example.com", "nonce"))
+	claims, err := provider.Authenticate(ctx, code, "verifier", "nonce")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if claims.Subject != "sub-1" || claims.Email != "a@example.com" {
+		t.Errorf("Authenticate() = %+v", claims)
+	}
+
+	// Codes are single use.
+	if _, err := provider.Authenticate(ctx, code, "verifier", "nonce"); err == nil {
+		t.Error("Authenticate() accepted a used code")
+	}
+
+	code = issuer.Code(issuer.Claims("sub-1", "a@example.com", "other"))
+	if _, err := provider.Authenticate(ctx, code, "verifier", "nonce"); err == nil {
+		t.Error("Authenticate() accepted an ID token with the wrong nonce")
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	url, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	for _, want := range []string{issuer.URL + "/authorize?", "state=state", "nonce=nonce", "code_challenge=challenge", "code_challenge_method=S256"} {
+		if !strings.Contains(url, want) {
+			t.Errorf("AuthCodeURL() = %s, missing %s", url, want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package oidc
+
+import (
+	"errors"
+	"socialmedia/config"
+)
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// Registry holds the configured identity providers by name.
+type Registry struct {
+	providers map[string]*Provider
+}
+
+// NewRegistry builds a registry from provider configuration. Discovery is
+// deferred until a provider is first used so startup never blocks on the
+// network.
+func NewRegistry(configs []config.OIDCProvider) *Registry {
+	r := &Registry{providers: make(map[string]*Provider)}
+	for _, cfg := range configs {
+		r.providers[cfg.Name] = NewProvider(cfg)
+	}
+	return r
+}
+
+// Get returns the provider with the given name.
+func (r *Registry) Get(name string) (*Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Names lists the configured provider names.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalRoundTrip(t *testing.T) {
+	l := NewLocal(t.TempDir(), "https://api.example.com/media/")
+	ctx := context.Background()
+	data := []byte("hello")
+
+	obj, err := l.Put(ctx, "posts/ab/file.txt", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if obj.Key != "posts/ab/file.txt" || obj.URL != "https://api.example.com/media/posts/ab/file.txt" {
+		t.Errorf("Put() = %+v", obj)
+	}
+
+	r, err := l.Get(ctx, obj.Key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get() = %q, want %q", got, data)
+	}
+
+	// Overwriting replaces the file and leaves no temporary files behind.
+	if _, err := l.Put(ctx, obj.Key, strings.NewReader("bye"), -1, "text/plain"); err != nil {
+		t.Fatalf("Put() over an existing key error = %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(l.Dir, "posts", "ab"))
+	if len(entries) != 1 {
+		t.Errorf("files after overwrite = %d, want 1", len(entries))
+	}
+
+	if err := l.Delete(ctx, obj.Key); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := l.Get(ctx, obj.Key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := l.Delete(ctx, obj.Key); err != nil {
+		t.Errorf("Delete() of a missing key error = %v", err)
+	}
+	if _, err := l.Get(ctx, "posts/ab"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a directory error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalRejectsPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "uploads")
+	l := NewLocal(dir, "/media")
+	ctx := context.Background()
+
+	outside := filepath.Join(root, "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{
+		"../secret.txt",
+		"posts/../../secret.txt",
+		"/secret.txt",
+		"posts//file.txt",
+		"posts/./file.txt",
+		"posts/",
+		"",
+		".",
+		"..",
+	} {
+		if _, err := l.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, err := l.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrNotFound", key, err)
+		}
+		if err := l.Delete(ctx, key); err != nil {
+			t.Errorf("Delete(%q) error = %v", key, err)
+		}
+	}
+
+	if got, err := os.ReadFile(outside); err != nil || string(got) != "secret" {
+		t.Errorf("file outside the directory = %q, %v", got, err)
+	}
+}
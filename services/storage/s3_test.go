@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// newTestS3 returns a backend for the bucket named by S3_TEST_BUCKET on
+// S3_TEST_ENDPOINT, e.g. a local MinIO server, creating the bucket if
+// needed. The test is skipped when no endpoint is set.
+func newTestS3(t *testing.T) *S3 {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	bucket := os.Getenv("S3_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "socialmedia-test"
+	}
+	s3, err := NewS3(S3Config{
+		Endpoint:  endpoint,
+		Region:    os.Getenv("S3_TEST_REGION"),
+		Bucket:    bucket,
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	exists, err := s3.client.BucketExists(ctx, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		if err := s3.client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s3
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	s3 := newTestS3(t)
+	ctx := context.Background()
+	key, err := NewKey("test", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("hello from the storage test")
+
+	obj, err := s3.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	t.Cleanup(func() { s3.Delete(ctx, obj.Key) })
+	if obj.Key != key || obj.URL != s3.publicURL+"/"+key {
+		t.Errorf("Put() = %+v", obj)
+	}
+
+	r, err := s3.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get() = %q, %v; want %q", got, err, data)
+	}
+
+	// Unknown size, as when streaming.
+	if _, err := s3.Put(ctx, key, bytes.NewReader(data), -1, "text/plain"); err != nil {
+		t.Errorf("Put() with unknown size error = %v", err)
+	}
+
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := s3.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Errorf("Delete() of a missing key error = %v", err)
+	}
+}
+
+func TestS3PresignedPost(t *testing.T) {
+	s3 := newTestS3(t)
+	ctx := context.Background()
+	key, err := NewKey("test", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s3.Delete(ctx, key) })
+
+	url, fields, err := s3.PresignedPost(ctx, key, "text/plain", 100, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignedPost() error = %v", err)
+	}
+
+	// The policy only admits a file of the given type and size.
+	raw, err := base64.StdEncoding.DecodeString(fields["policy"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var policy struct {
+		Conditions []interface{} `json:"conditions"`
+	}
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		t.Fatal(err)
+	}
+	conditions := fmt.Sprint(policy.Conditions)
+	for _, want := range []string{"[content-length-range 1 100]", "[eq $Content-Type text/plain]", "[eq $key " + key + "]"} {
+		if !strings.Contains(conditions, want) {
+			t.Errorf("policy conditions = %s, want %s", conditions, want)
+		}
+	}
+
+	data := []byte("uploaded directly")
+	var form bytes.Buffer
+	w := multipart.NewWriter(&form)
+	for name, value := range fields {
+		w.WriteField(name, value)
+	}
+	part, err := w.CreateFormFile("file", "upload.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	w.Close()
+	resp, err := http.Post(url, w.FormDataContentType(), &form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		t.Fatalf("POST presigned URL = %d", resp.StatusCode)
+	}
+
+	r, err := s3.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer r.Close()
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, data) {
+		t.Errorf("Get() = %q, want %q", got, data)
+	}
+}
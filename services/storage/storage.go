@@ -0,0 +1,164 @@
+// Package storage keeps uploaded files on a pluggable backend: the local
+// disk, an S3-compatible bucket or Uploadcare.
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"socialmedia/config"
+	"socialmedia/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Get for keys that hold no object.
+var ErrNotFound = errors.New("object not found")
+
+// Object is a stored file. Key is what to pass to Get and Delete; it can
+// differ from the key the object was put under, since
+// some backends pick their own. URL is where the object is served from.
+type Object struct {
+	Key string
+	URL string
+}
+
+// Backend stores objects by key.
+type Backend interface {
+	// Put stores size bytes read from r under key. size is -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (Object, error)
+	// Get opens the object stored under key, or returns ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key. Deleting a missing
+	// object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by backends that let clients upload objects
+// directly, without going through the API.
+type Presigner interface {
+	// PresignedPost returns a URL that accepts a multipart form POST of
+	// the object stored under key until expiry, and the fields the form
+	// must carry before the file. Only a file of contentType and at most
+	// maxSize bytes is accepted.
+	PresignedPost(ctx context.Context, key, contentType string, maxSize int64, expiry time.Duration) (string, map[string]string, error)
+}
+
+var (
+	backend Backend = NewLocal("uploads", "/media")
+	mutex   sync.RWMutex
+)
+
+// SetBackend replaces the backend returned by Current.
+func SetBackend(b Backend) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	backend = b
+}
+
+// Current returns the backend in use.
+func Current() Backend {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return backend
+}
+
+// Configure selects the backend named by config.StorageBackend.
+func Configure() error {
+	switch config.StorageBackend {
+	case "local":
+		SetBackend(NewLocal(config.StorageLocalDir, config.StorageLocalURL))
+	case "s3":
+		s3, err := NewS3(S3Config{
+			Endpoint:  config.S3Endpoint,
+			Region:    config.S3Region,
+			Bucket:    config.S3Bucket,
+			AccessKey: config.S3AccessKey,
+			SecretKey: config.S3SecretKey,
+			UseSSL:    config.S3UseSSL,
+			PublicURL: config.S3PublicURL,
+		})
+		if err != nil {
+			return err
+		}
+		SetBackend(s3)
+	case "uploadcare":
+		if config.UploadcarePublicKey == "" {
+			return errors.New("UPLOADCARE_PUBLIC_KEY is not set")
+		}
+		SetBackend(NewUploadcare(config.UploadcarePublicKey, config.UploadcareSecretKey))
+	default:
+		log.Printf("Unknown STORAGE_BACKEND %q, using local", config.StorageBackend)
+		SetBackend(NewLocal(config.StorageLocalDir, config.StorageLocalURL))
+	}
+	return nil
+}
+
+// extensions maps the content types we expect to store to the extension
+// their keys get.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// NewKey returns a fresh random key under prefix, with an extension that
+// matches contentType so the object is served with the right type.
+func NewKey(prefix, contentType string) (string, error) {
+	name, err := utils.GenerateSecureToken(18)
+	if err != nil {
+		return "", err
+	}
+	return prefix + "/" + time.Now().UTC().Format("2006/01") + "/" + name + extensions[contentType], nil
+}
+
+// DetectContentType sniffs the content type of data from its first 512
+// bytes, without parameters such as the charset.
+func DetectContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
+
+// Upload stores r on the current backend under a new key below prefix and
+// returns the object along with its content type, which is sniffed from the
+// data rather than trusted from the client.
+func Upload(ctx context.Context, prefix string, r io.Reader, size int64) (Object, string, error) {
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return Object{}, "", err
+	}
+	contentType := DetectContentType(head)
+
+	key, err := NewKey(prefix, contentType)
+	if err != nil {
+		return Object{}, "", err
+	}
+	obj, err := Current().Put(ctx, key, br, size, contentType)
+	if err != nil {
+		return Object{}, "", fmt.Errorf("storing %s: %w", key, err)
+	}
+	return obj, contentType, nil
+}
+
+// DeleteAll deletes the objects stored under keys from the current backend.
+// Failures are logged rather than returned: callers use it to clean up
+// after data that is already gone.
+func DeleteAll(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := Current().Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete stored object %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"socialmedia/config"
+	"strings"
+	"time"
+)
+
+// Uploadcare keeps objects on Uploadcare, which picks its own file IDs: the
+// key of a stored object is its UUID. Files are served publicly from the
+// CDN.
+type Uploadcare struct {
+	PublicKey string
+	SecretKey string
+	UploadURL string
+	APIURL    string
+	CDNURL    string
+	Client    *http.Client
+}
+
+// NewUploadcare returns a backend for the project with the given keys, using
+// the endpoints from config.
+func NewUploadcare(publicKey, secretKey string) *Uploadcare {
+	return &Uploadcare{
+		PublicKey: publicKey,
+		SecretKey: secretKey,
+		UploadURL: strings.TrimSuffix(config.UploadcareUploadURL, "/"),
+		APIURL:    strings.TrimSuffix(config.UploadcareAPIURL, "/"),
+		CDNURL:    strings.TrimSuffix(config.UploadcareCDNURL, "/"),
+		Client:    &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (u *Uploadcare) fileURL(uuid string) string {
+	return u.CDNURL + "/" + uuid + "/"
+}
+
+// do sends req and returns the response, turning non-2xx statuses into
+// errors.
+func (u *Uploadcare) do(req *http.Request) (*http.Response, error) {
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return resp, fmt.Errorf("uploadcare: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// Put uploads the object through the upload API, streaming it rather than
+// buffering the whole form. The file name Uploadcare records is the last
+// element of key.
+func (u *Uploadcare) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (Object, error) {
+	body, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		writer.WriteField("UPLOADCARE_PUB_KEY", u.PublicKey)
+		writer.WriteField("UPLOADCARE_STORE", "1") // Auto store the file
+		part, err := writer.CreateFormFile("file", path.Base(key))
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.UploadURL+"/base/", body)
+	if err != nil {
+		body.Close()
+		return Object{}, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := u.do(req)
+	// Unblock the writer if the request stopped reading early.
+	body.Close()
+	if err != nil {
+		return Object{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		File string `json:"file"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Object{}, err
+	}
+	if result.File == "" {
+		return Object{}, fmt.Errorf("uploadcare: no file ID in response")
+	}
+	return Object{Key: result.File, URL: u.fileURL(result.File)}, nil
+}
+
+// Get downloads the object from the CDN.
+func (u *Uploadcare) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.fileURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.do(req)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object through the REST API, which needs the secret
+// key.
+func (u *Uploadcare) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.APIURL+"/files/"+key+"/storage/", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.uploadcare-v0.7+json")
+	req.Header.Set("Authorization", "Uploadcare.Simple "+u.PublicKey+":"+u.SecretKey)
+	resp, err := u.do(req)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
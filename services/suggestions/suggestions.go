@@ -0,0 +1,208 @@
+// Package suggestions works out who a user might want to follow and caches
+// the result.
+package suggestions
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"socialmedia/models"
+
+	"gorm.io/gorm"
+)
+
+// CacheSize is how many suggestions are computed and cached per user.
+const CacheSize = 50
+
+// ActivityWindow is how far back posts and comments count as recent
+// activity.
+const ActivityWindow = 14 * 24 * time.Hour
+
+// Signal weights. A recommendation from someone you follow counts for more
+// than having engaged with the same post, and both count for more than
+// simply being active. Activity is capped so prolific posters cannot drown
+// out the social signals.
+const (
+	followedByWeight = 3
+	sharedWeight     = 2
+	activityCap      = 5
+)
+
+// signalsSQL counts, per candidate, how many of the user's followings follow
+// them, on how many posts they liked or commented where the user did too,
+// and how many posts and comments they wrote since the activity cutoff.
+const signalsSQL = `
+SELECT candidate_id,
+	SUM(followed_by) AS followed_by,
+	SUM(shared) AS shared,
+	SUM(recent) AS recent
+FROM (
+	SELECT f2.following_id AS candidate_id, 1 AS followed_by, 0 AS shared, 0 AS recent
+	FROM follows f1 JOIN follows f2 ON f2.follower_id = f1.following_id
+	WHERE f1.follower_id = ?
+
+	UNION ALL
+
+	SELECT theirs.user_id, 0, 1, 0
+	FROM (` + engagementsSQL + `) mine
+	JOIN (` + engagementsSQL + `) theirs ON theirs.post_id = mine.post_id AND theirs.user_id <> mine.user_id
+	WHERE mine.user_id = ?
+
+	UNION ALL
+
+	SELECT user_id, 0, 0, 1 FROM posts WHERE deleted_at IS NULL AND created_at > ?
+
+	UNION ALL
+
+	SELECT user_id, 0, 0, 1 FROM comments WHERE deleted_at IS NULL AND created_at > ?
+) signals
+GROUP BY candidate_id`
+
+// engagementsSQL lists each (user, post) pair where the user liked or
+// commented on the post, once.
+const engagementsSQL = `
+	SELECT user_id, post_id FROM likes WHERE post_id IS NOT NULL AND deleted_at IS NULL
+	UNION
+	SELECT user_id, post_id FROM comments WHERE deleted_at IS NULL`
+
+// eligible is a query scope dropping rows whose column refers to someone
+// userID should not be suggested: themselves, hidden accounts, people they
+// already follow or have asked to follow, and people they have blocked,
+// muted or been blocked by.
+func eligible(userID uint, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Where(column+" <> ?", userID).
+			Where(column+" IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&models.User{}).Select("id").Scopes(models.VisibleUsers)).
+			Where(column+" NOT IN (SELECT following_id FROM follows WHERE follower_id = ?)", userID).
+			Where(column+" NOT IN (SELECT target_id FROM follow_requests WHERE requester_id = ?)", userID).
+			Scopes(models.HideBlockedAndMuted(userID, column))
+	}
+}
+
+// Compute scores every eligible candidate for userID and replaces their
+// cached suggestions with the best CacheSize. Users with no signals at all
+// are still ranked, by follower count, so that someone who follows nobody
+// yet gets the most followed accounts.
+func Compute(db *gorm.DB, userID uint, now time.Time) ([]models.Suggestion, error) {
+	since := now.Add(-ActivityWindow)
+	signals := db.Raw(signalsSQL, userID, userID, since, since)
+
+	var rows []struct {
+		ID         uint
+		Score      int64
+		FollowedBy int64
+	}
+	err := db.Model(&models.User{}).
+		Select(`users.id,
+			COALESCE(s.followed_by, 0) AS followed_by,
+			COALESCE(s.followed_by, 0) * ? + COALESCE(s.shared, 0) * ? + MIN(COALESCE(s.recent, 0), ?) AS score`,
+			followedByWeight, sharedWeight, activityCap).
+		Joins("LEFT JOIN (?) AS s ON s.candidate_id = users.id", signals).
+		Scopes(eligible(userID, "users.id")).
+		Order("score desc, users.follower_count desc, users.id").
+		Limit(CacheSize).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]models.Suggestion, len(rows))
+	for i, r := range rows {
+		suggestions[i] = models.Suggestion{
+			UserID:      userID,
+			SuggestedID: r.ID,
+			Position:    i,
+			Score:       r.Score,
+			FollowedBy:  r.FollowedBy,
+			CreatedAt:   now,
+		}
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Suggestion{}).Error; err != nil {
+			return err
+		}
+		if len(suggestions) > 0 {
+			if err := tx.Create(&suggestions).Error; err != nil {
+				return err
+			}
+		}
+		// Recorded even for an empty result, so ForUser does not recompute
+		// it on every request until it expires.
+		return tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("suggestions_computed_at", now).Error
+	})
+	return suggestions, err
+}
+
+// ForUser returns userID's cached suggestions in order, recomputing them
+// first if they are missing or older than ttl. Entries that stopped being
+// eligible since they were cached, say because the user followed them in
+// the meantime, are left out.
+func ForUser(db *gorm.DB, userID uint, ttl time.Duration, now time.Time) ([]models.Suggestion, error) {
+	var user models.User
+	if err := db.Select("suggestions_computed_at").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.SuggestionsComputedAt == nil || now.Sub(*user.SuggestionsComputedAt) > ttl {
+		if _, err := Compute(db, userID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	var suggestions []models.Suggestion
+	err := db.Where("user_id = ?", userID).
+		Scopes(eligible(userID, "suggested_id")).
+		Order("position").
+		Find(&suggestions).Error
+	return suggestions, err
+}
+
+// RefreshStale recomputes the caches older than ttl of users who have been
+// active since they were computed, and returns how many were refreshed.
+// Caches of users who have not been back are left until they next ask.
+func RefreshStale(db *gorm.DB, ttl time.Duration, now time.Time) (int, error) {
+	var userIDs []uint
+	err := db.Model(&models.User{}).
+		Where("suggestions_computed_at < ?", now.Add(-ttl)).
+		Where("suggestions_computed_at < (SELECT MAX(last_seen_at) FROM sessions WHERE sessions.user_id = users.id AND sessions.deleted_at IS NULL)").
+		Pluck("id", &userIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	refreshed := 0
+	for _, id := range userIDs {
+		if _, err := Compute(db, id, now); err != nil {
+			log.Printf("Failed to refresh suggestions for user %d: %v", id, err)
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, nil
+}
+
+// StartRefresher periodically refreshes stale suggestion caches until ctx is
+// cancelled.
+func StartRefresher(ctx context.Context, db *gorm.DB, ttl, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				refreshed, err := RefreshStale(db, ttl, now)
+				if err != nil {
+					log.Printf("Suggestion refresh failed: %v", err)
+					continue
+				}
+				if refreshed > 0 {
+					log.Printf("Refreshed suggestions for %d users", refreshed)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,176 @@
+package suggestions
+
+import (
+	"testing"
+	"time"
+
+	"socialmedia/internal/testutil"
+	"socialmedia/models"
+
+	"gorm.io/gorm"
+)
+
+func createUser(t *testing.T, db *gorm.DB, username string) models.User {
+	t.Helper()
+	user := models.User{Email: username + "@example.com", Username: username, Name: username}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestForUserCachesEmptyResult(t *testing.T) {
+	db := testutil.NewDB(t)
+	user := createUser(t, db, "alice")
+	ttl := time.Hour
+	now := time.Now()
+
+	got, err := ForUser(db, user.ID, ttl, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("suggestions = %d, want none", len(got))
+	}
+	var rows int64
+	if err := db.Model(&models.Suggestion{}).Count(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rows != 0 {
+		t.Errorf("cached rows = %d, want none for an empty result", rows)
+	}
+
+	// Someone to suggest turns up, but the empty result is still fresh.
+	bob := createUser(t, db, "bob")
+	got, err = ForUser(db, user.ID, ttl, now.Add(ttl/2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("suggestions within the TTL = %d, want the cached empty result", len(got))
+	}
+
+	got, err = ForUser(db, user.ID, ttl, now.Add(ttl+time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].SuggestedID != bob.ID {
+		t.Fatalf("suggestions after the TTL = %+v, want bob", got)
+	}
+}
+
+func TestRefreshStaleRefreshesEmptyResult(t *testing.T) {
+	db := testutil.NewDB(t)
+	user := createUser(t, db, "alice")
+	ttl := time.Hour
+	computed := time.Now().Add(-2 * ttl)
+
+	if _, err := Compute(db, user.ID, computed); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Session{UserID: user.ID, RefreshTokenHash: "hash", LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(ttl)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	createUser(t, db, "bob")
+
+	refreshed, err := RefreshStale(db, ttl, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed != 1 {
+		t.Errorf("refreshed = %d, want 1", refreshed)
+	}
+}
+
+func TestComputeScoresAndExcludes(t *testing.T) {
+	db := testutil.NewDB(t)
+	now := time.Now()
+	create := func(rows ...interface{}) {
+		t.Helper()
+		for _, row := range rows {
+			if err := db.Create(row).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	alice := createUser(t, db, "alice")
+	carol := createUser(t, db, "carol")
+	create(&models.Follow{FollowerID: alice.ID, FollowingID: carol.ID})
+
+	// dave is followed by someone alice follows: 3.
+	dave := createUser(t, db, "dave")
+	create(&models.Follow{FollowerID: carol.ID, FollowingID: dave.ID})
+	// eve liked a post alice commented on: 2.
+	eve := createUser(t, db, "eve")
+	post := models.Post{UserID: carol.ID, Content: "post", Model: gorm.Model{CreatedAt: now.Add(-2 * ActivityWindow)}}
+	create(&post)
+	create(&models.Comment{UserID: alice.ID, PostID: post.ID, Content: "nice", Model: gorm.Model{CreatedAt: now.Add(-2 * ActivityWindow)}},
+		&models.Like{UserID: eve.ID, PostID: &post.ID})
+	// frank posted a lot lately, which counts for at most activityCap,
+	// and before the window, which does not count.
+	frank := createUser(t, db, "frank")
+	for i := 0; i < activityCap+2; i++ {
+		create(&models.Post{UserID: frank.ID, Content: "recent", Model: gorm.Model{CreatedAt: now.Add(-time.Hour)}})
+	}
+	create(&models.Post{UserID: frank.ID, Content: "old", Model: gorm.Model{CreatedAt: now.Add(-2 * ActivityWindow)}})
+	// No signals: ranked by follower count.
+	grace := createUser(t, db, "grace")
+	henry := createUser(t, db, "henry")
+	db.Model(&grace).UpdateColumn("follower_count", 10)
+	db.Model(&henry).UpdateColumn("follower_count", 2)
+
+	// Everyone below would be a strong candidate, but must never be
+	// suggested.
+	excluded := map[string]func(models.User){
+		"blocked":   func(u models.User) { create(&models.Block{BlockerID: alice.ID, BlockedID: u.ID}) },
+		"blocker":   func(u models.User) { create(&models.Block{BlockerID: u.ID, BlockedID: alice.ID}) },
+		"muted":     func(u models.User) { create(&models.Mute{MuterID: alice.ID, MutedID: u.ID}) },
+		"followed":  func(u models.User) { create(&models.Follow{FollowerID: alice.ID, FollowingID: u.ID}) },
+		"requested": func(u models.User) { create(&models.FollowRequest{RequesterID: alice.ID, TargetID: u.ID}) },
+		"suspended": func(u models.User) { db.Model(&u).UpdateColumn("suspended_at", now) },
+		"leaving":   func(u models.User) { db.Model(&u).UpdateColumn("deletion_scheduled_at", now) },
+	}
+	for name, exclude := range excluded {
+		u := createUser(t, db, name)
+		create(&models.Follow{FollowerID: carol.ID, FollowingID: u.ID})
+		exclude(u)
+	}
+
+	got, err := Compute(db, alice.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		id                uint
+		score, followedBy int64
+	}{
+		{frank.ID, activityCap, 0},
+		{dave.ID, followedByWeight, 1},
+		{eve.ID, sharedWeight, 0},
+		{grace.ID, 0, 0},
+		{henry.ID, 0, 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("suggestions = %+v, want %d", got, len(want))
+	}
+	for i, w := range want {
+		if g := got[i]; g.SuggestedID != w.id || g.Score != w.score || g.FollowedBy != w.followedBy || g.Position != i {
+			t.Errorf("suggestion %d = %+v, want user %d scoring %d", i, g, w.id, w.score)
+		}
+	}
+
+	// Following someone after the cache was computed drops them at once.
+	create(&models.Follow{FollowerID: alice.ID, FollowingID: dave.ID})
+	cached, err := ForUser(db, alice.ID, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != len(want)-1 {
+		t.Fatalf("cached suggestions = %d, want %d", len(cached), len(want)-1)
+	}
+	for _, s := range cached {
+		if s.SuggestedID == dave.ID {
+			t.Error("dave is still suggested after being followed")
+		}
+	}
+}
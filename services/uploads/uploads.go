@@ -0,0 +1,83 @@
+// Package uploads cleans up after direct uploads that were never completed,
+// media that was never attached to a post and media left on deleted posts.
+package uploads
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"socialmedia/models"
+	"socialmedia/services/storage"
+
+	"gorm.io/gorm"
+)
+
+// Sweep deletes upload sessions that have expired by now, along with any
+// file sent for those that were never completed, media uploaded more than
+// pendingTTL before now that is still not attached to a post, and media on
+// posts that have been deleted. It returns how many sessions and media were
+// removed.
+func Sweep(ctx context.Context, db *gorm.DB, now time.Time, pendingTTL time.Duration) (int, error) {
+	var expired []models.Upload
+	if err := db.Where("expires_at <= ?", now).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+	var ids []uint
+	var unused []string
+	for _, upload := range expired {
+		ids = append(ids, upload.ID)
+		if upload.CompletedAt == nil {
+			unused = append(unused, upload.StorageKey)
+		}
+	}
+	if len(ids) > 0 {
+		if err := db.Where("id IN ?", ids).Delete(&models.Upload{}).Error; err != nil {
+			return 0, err
+		}
+	}
+	storage.DeleteAll(ctx, unused)
+
+	var mediaIDs []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		livePosts := tx.Model(&models.Post{}).Select("id")
+		if err := tx.Model(&models.Media{}).
+			Where("post_id IS NULL AND created_at <= ?", now.Add(-pendingTTL)).
+			Or("post_id IS NOT NULL AND post_id NOT IN (?)", livePosts).
+			Pluck("id", &mediaIDs).Error; err != nil {
+			return err
+		}
+		var err error
+		unused, err = models.DeleteMedia(tx, mediaIDs)
+		return err
+	})
+	if err != nil {
+		return len(ids), err
+	}
+	storage.DeleteAll(ctx, unused)
+	return len(ids) + len(mediaIDs), nil
+}
+
+// StartSweeper periodically sweeps expired uploads and unattached media
+// until ctx is cancelled.
+func StartSweeper(ctx context.Context, db *gorm.DB, interval, pendingTTL time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				removed, err := Sweep(ctx, db, now, pendingTTL)
+				if err != nil {
+					log.Printf("Upload sweep failed: %v", err)
+					continue
+				}
+				if removed > 0 {
+					log.Printf("Swept %d expired uploads and unattached media", removed)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,119 @@
+package uploads
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"socialmedia/internal/testutil"
+	"socialmedia/models"
+	"socialmedia/services/storage"
+)
+
+// putFile stores a file under key.
+func putFile(t *testing.T, backend storage.Backend, key string) {
+	t.Helper()
+	if _, err := backend.Put(context.Background(), key, strings.NewReader("data"), 4, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(backend storage.Backend, key string) bool {
+	r, err := backend.Get(context.Background(), key)
+	if err != nil {
+		return false
+	}
+	r.Close()
+	return true
+}
+
+func TestSweep(t *testing.T) {
+	db := testutil.NewDB(t)
+	backend := testutil.UseStorage(t)
+	now := time.Now()
+	ttl := time.Hour
+
+	user := models.User{Email: "alice@example.com", Username: "alice", Name: "Alice", StorageUsed: 4 * 4}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	live := models.Post{UserID: user.ID, Content: "live"}
+	deleted := models.Post{UserID: user.ID, Content: "deleted"}
+	if err := db.Create(&live).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Uploads: expired before being completed, expired after, and open.
+	sessions := []models.Upload{
+		{UserID: user.ID, StorageKey: "uploads/expired", ExpiresAt: now.Add(-time.Minute)},
+		{UserID: user.ID, StorageKey: "uploads/completed", ExpiresAt: now.Add(-time.Minute), CompletedAt: &now},
+		{UserID: user.ID, StorageKey: "uploads/open", ExpiresAt: now.Add(time.Minute)},
+	}
+	for i := range sessions {
+		sessions[i].ContentType, sessions[i].Size = "image/png", 4
+		putFile(t, backend, sessions[i].StorageKey)
+		if err := db.Create(&sessions[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Media: left unattached too long, unattached but recent, on a live
+	// post and on a deleted post.
+	media := []models.Media{
+		{StorageKey: "media/stale", CreatedAt: now.Add(-2 * ttl)},
+		{StorageKey: "media/pending", CreatedAt: now},
+		{StorageKey: "media/live", PostID: &live.ID},
+		{StorageKey: "media/deleted", PostID: &deleted.ID},
+	}
+	for i := range media {
+		media[i].UserID, media[i].Type, media[i].URL, media[i].Size = user.ID, models.ImageType, "/media/"+media[i].StorageKey, 4
+		putFile(t, backend, media[i].StorageKey)
+		if err := db.Create(&media[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := Sweep(context.Background(), db, now, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 4 {
+		t.Errorf("removed = %d, want 2 uploads and 2 media", removed)
+	}
+
+	var left []uint
+	db.Model(&models.Upload{}).Order("id").Pluck("id", &left)
+	if len(left) != 1 || left[0] != sessions[2].ID {
+		t.Errorf("uploads left = %v, want the open one", left)
+	}
+	db.Model(&models.Media{}).Order("id").Pluck("id", &left)
+	if len(left) != 2 || left[0] != media[1].ID || left[1] != media[2].ID {
+		t.Errorf("media left = %v, want the pending and live ones", left)
+	}
+	for key, want := range map[string]bool{
+		"uploads/expired":   false,
+		"uploads/completed": true, // completing it dealt with the file
+		"uploads/open":      true,
+		"media/stale":       false,
+		"media/pending":     true,
+		"media/live":        true,
+		"media/deleted":     false,
+	} {
+		if got := exists(backend, key); got != want {
+			t.Errorf("%s stored = %v, want %v", key, got, want)
+		}
+	}
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.StorageUsed != 2*4 {
+		t.Errorf("storage used = %d, want %d", user.StorageUsed, 2*4)
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"socialmedia/config"
+	"strings"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// SignValue returns payload encoded as "<base64 payload>.<base64 HMAC>" using
+// the server secret, suitable for storing in a cookie.
+func SignValue(payload []byte) string {
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(encoded))
+}
+
+// VerifySignedValue checks a value produced by SignValue and returns its payload.
+func VerifySignedValue(value string) ([]byte, error) {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, sign(encoded)) {
+		return nil, ErrInvalidSignature
+	}
+	return base64.RawURLEncoding.DecodeString(encoded)
+}
+
+func sign(data string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.JWTSecret))
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// PKCEChallenge derives the S256 code challenge for a PKCE code verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}